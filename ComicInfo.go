@@ -5,22 +5,231 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
+// ComicInfo 对应 ComicInfo.xml v2.1, 字段顺序与 schema 中的 sequence 一致
 type ComicInfo struct {
-	Series string `xml:"Series"`
-	Writer string `xml:"Writer"`
-	// Publisher string `xml:"Publisher"`
-	Genre   string `xml:"Genre"`
-	Summary string `xml:"Summary"`
-	Title   string `xml:"Title"`
-	Number  string `xml:"Number"`
-	// Volume    string `xml:"Volume"`
-	PageCount string `xml:"PageCount"`
+	XMLName         xml.Name `xml:"ComicInfo"`
+	XmlnsXsi        string   `xml:"xmlns:xsi,attr"`
+	XmlnsXsd        string   `xml:"xmlns:xsd,attr"`
+	Title           string   `xml:"Title,omitempty"`
+	Series          string   `xml:"Series,omitempty"`
+	Number          string   `xml:"Number,omitempty"`
+	Count           int      `xml:"Count,omitempty"`
+	Volume          int      `xml:"Volume,omitempty"`
+	AlternateSeries string   `xml:"AlternateSeries,omitempty"`
+	AlternateNumber string   `xml:"AlternateNumber,omitempty"`
+	AlternateCount  int      `xml:"AlternateCount,omitempty"`
+	Summary         string   `xml:"Summary,omitempty"`
+	Notes           string   `xml:"Notes,omitempty"`
+	Year            int      `xml:"Year,omitempty"`
+	Month           int      `xml:"Month,omitempty"`
+	Day             int      `xml:"Day,omitempty"`
+	Writer          string   `xml:"Writer,omitempty"`
+	Penciller       string   `xml:"Penciller,omitempty"`
+	Inker           string   `xml:"Inker,omitempty"`
+	Colorist        string   `xml:"Colorist,omitempty"`
+	Letterer        string   `xml:"Letterer,omitempty"`
+	CoverArtist     string   `xml:"CoverArtist,omitempty"`
+	Editor          string   `xml:"Editor,omitempty"`
+	Translator      string   `xml:"Translator,omitempty"`
+	Publisher       string   `xml:"Publisher,omitempty"`
+	Imprint         string   `xml:"Imprint,omitempty"`
+	Genre           string   `xml:"Genre,omitempty"`
+	Tags            string   `xml:"Tags,omitempty"`
+	Web             string   `xml:"Web,omitempty"`
+	PageCount       int      `xml:"PageCount,omitempty"`
+	LanguageISO     string   `xml:"LanguageISO,omitempty"`
+	Format          string   `xml:"Format,omitempty"`
+	BlackAndWhite   string   `xml:"BlackAndWhite,omitempty"`
+	Manga           string   `xml:"Manga,omitempty"`
+	Characters      string   `xml:"Characters,omitempty"`
+	Teams           string   `xml:"Teams,omitempty"`
+	Locations       string   `xml:"Locations,omitempty"`
+	ScanInformation string   `xml:"ScanInformation,omitempty"`
+	StoryArc        string   `xml:"StoryArc,omitempty"`
+	StoryArcNumber  string   `xml:"StoryArcNumber,omitempty"`
+	SeriesGroup     string   `xml:"SeriesGroup,omitempty"`
+	AgeRating       string   `xml:"AgeRating,omitempty"`
+	Pages           *struct {
+		Page []ComicPageInfo `xml:"Page"`
+	} `xml:"Pages,omitempty"`
+	CommunityRating     string `xml:"CommunityRating,omitempty"`
+	MainCharacterOrTeam string `xml:"MainCharacterOrTeam,omitempty"`
+	Review              string `xml:"Review,omitempty"`
+	GTIN                string `xml:"GTIN,omitempty"`
+}
+
+// ComicPageInfo 对应 schema 中的 ComicPageInfo
+type ComicPageInfo struct {
+	Image       int    `xml:"Image,attr"`
+	Type        string `xml:"Type,attr,omitempty"`
+	DoublePage  bool   `xml:"DoublePage,attr,omitempty"`
+	ImageSize   int64  `xml:"ImageSize,attr,omitempty"`
+	Key         string `xml:"Key,attr,omitempty"`
+	Bookmark    string `xml:"Bookmark,attr,omitempty"`
+	ImageWidth  int    `xml:"ImageWidth,attr,omitempty"`
+	ImageHeight int    `xml:"ImageHeight,attr,omitempty"`
+}
+
+// schema 中的枚举值
+var (
+	comicYesNo     = []string{"Unknown", "No", "Yes"}
+	comicManga     = []string{"Unknown", "No", "Yes", "YesAndRightToLeft"}
+	comicAgeRating = []string{"Unknown", "Adults Only 18+", "Early Childhood", "Everyone", "Everyone 10+",
+		"G", "Kids to Adults", "M", "MA15+", "Mature 17+", "PG", "R18+", "Rating Pending", "Teen", "X18+"}
+	comicPageType = []string{"FrontCover", "InnerCover", "Roundup", "Story", "Advertisement", "Editorial",
+		"Letters", "Preview", "BackCover", "Other", "Deleted"}
+)
+
+// NewComicInfo 根据任务和已下载的页面生成 ComicInfo
+func NewComicInfo(d *DownloaderSingle, pages []PageInfo) ComicInfo {
+	chapter := d.Chapter
+	comicInfo := ComicInfo{
+		XmlnsXsi:    "http://www.w3.org/2001/XMLSchema-instance",
+		XmlnsXsd:    "http://www.w3.org/2001/XMLSchema",
+		Title:       chapter.Name,
+		Series:      d.BookInfo.Series,
+		Number:      fmt.Sprintf("%d", chapter.Index+1),
+		Summary:     d.BookInfo.Description,
+		Notes:       d.identity(),
+		Writer:      d.BookInfo.Author,
+		Genre:       d.BookInfo.Genre,
+		Tags:        strings.Join(d.BookInfo.Tags, ", "),
+		Web:         fmt.Sprintf("https://%s/comic/%s", d.urlBase, d.PathWord),
+		PageCount:   len(pages),
+		LanguageISO: "zh",
+		Manga:       comicMangaByRegion(d.BookInfo),
+		AgeRating:   comicAgeRatingByRestrict(d.BookInfo.Restrict),
+		// 源站不提供汉化组信息, 以章节所在的分组代替
+		Translator:      d.Group,
+		ScanInformation: d.Group,
+	}
+	if chapter.Type == 2 {
+		comicInfo.Volume = chapter.Index + 1
+	}
+	if d.BookInfo.Finished {
+		comicInfo.Count = chapter.Count
+	}
+	if created, err := time.Parse("2006-01-02", chapter.DatetimeCreated); err == nil {
+		comicInfo.Year, comicInfo.Month, comicInfo.Day = created.Year(), int(created.Month()), created.Day()
+	}
+
+	if len(pages) > 0 {
+		comicInfo.Pages = &struct {
+			Page []ComicPageInfo `xml:"Page"`
+		}{}
+		for i, page := range pages {
+			info := ComicPageInfo{
+				Image:       i,
+				ImageSize:   page.Size,
+				ImageWidth:  page.Width,
+				ImageHeight: page.Height,
+			}
+			if i == 0 {
+				info.Type = "FrontCover"
+			}
+			comicInfo.Pages.Page = append(comicInfo.Pages.Page, info)
+		}
+	}
+	return comicInfo
+}
+
+// comicMangaByRegion 按地区判断阅读方向, 地区未知时不猜测
+func comicMangaByRegion(bookInfo *BookInfo) string {
+	if bookInfo.RegionName == "" {
+		return "Unknown"
+	}
+	switch bookInfo.Region {
+	case 0:
+		return "YesAndRightToLeft"
+	case 1:
+		// 韩漫多为从左到右阅读的条漫
+		return "Yes"
+	case 2:
+		return "No"
+	}
+	return "Unknown"
+}
+
+func comicAgeRatingByRestrict(restrict string) string {
+	switch {
+	case restrict == "":
+		return ""
+	case strings.Contains(restrict, "18"):
+		return "Adults Only 18+"
+	case strings.Contains(restrict, "一般"):
+		return "Everyone"
+	}
+	return "Unknown"
+}
+
+// ValidatePartial 只检查 ComicInfo v2.1 schema 中的枚举值, 取值范围和页面编号,
+// 不是 XSD 校验, 通过检查不代表文件符合 schema
+func (c *ComicInfo) ValidatePartial() error {
+	enums := []struct {
+		name   string
+		value  string
+		values []string
+	}{
+		{"BlackAndWhite", c.BlackAndWhite, comicYesNo},
+		{"Manga", c.Manga, comicManga},
+		{"AgeRating", c.AgeRating, comicAgeRating},
+	}
+	if c.Pages != nil {
+		for _, page := range c.Pages.Page {
+			enums = append(enums, struct {
+				name   string
+				value  string
+				values []string
+			}{"Page Type", page.Type, comicPageType})
+		}
+	}
+	for _, enum := range enums {
+		if enum.value != "" && !containsString(enum.values, enum.value) {
+			return fmt.Errorf("invalid %s: %s", enum.name, enum.value)
+		}
+	}
+
+	switch {
+	case c.Count < 0 || c.Volume < 0 || c.AlternateCount < 0 || c.PageCount < 0:
+		return fmt.Errorf("negative count")
+	case c.Month < 0 || c.Month > 12:
+		return fmt.Errorf("invalid Month: %d", c.Month)
+	case c.Day < 0 || c.Day > 31:
+		return fmt.Errorf("invalid Day: %d", c.Day)
+	}
+	if c.Pages != nil {
+		seen := make(map[int]bool, len(c.Pages.Page))
+		for _, page := range c.Pages.Page {
+			if page.Image < 0 || seen[page.Image] {
+				return fmt.Errorf("invalid Page Image: %d", page.Image)
+			}
+			seen[page.Image] = true
+		}
+		if c.PageCount > 0 && len(c.Pages.Page) != c.PageCount {
+			return fmt.Errorf("Pages has %d entries, PageCount is %d", len(c.Pages.Page), c.PageCount)
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 // Build 方法将 ComicInfo 对象序列化并保存为 XML 文件
 func (c *ComicInfo) Build(outputPath string) error {
+	if err := c.ValidatePartial(); err != nil {
+		return fmt.Errorf("invalid ComicInfo: %v", err)
+	}
 	fileName := filepath.Join(outputPath, "ComicInfo.xml")
 
 	// 创建文件
@@ -30,6 +239,9 @@ func (c *ComicInfo) Build(outputPath string) error {
 	}
 	defer file.Close()
 
+	if _, err := file.WriteString(xml.Header); err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
 	// 创建 XML 编码器并序列化 ComicInfo
 	encoder := xml.NewEncoder(file)
 	encoder.Indent("", "  ") // 设置缩进
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestComicMangaByRegion(t *testing.T) {
+	tests := []struct {
+		bookInfo BookInfo
+		want     string
+	}{
+		// 没有获取到地区时 Region 也是 0, 不能当作日漫
+		{BookInfo{}, "Unknown"},
+		{BookInfo{Region: 0, RegionName: "日本"}, "YesAndRightToLeft"},
+		{BookInfo{Region: 1, RegionName: "韩国"}, "Yes"},
+		{BookInfo{Region: 2, RegionName: "欧美"}, "No"},
+		{BookInfo{Region: 5, RegionName: "其他"}, "Unknown"},
+	}
+	for _, tt := range tests {
+		if got := comicMangaByRegion(&tt.bookInfo); got != tt.want {
+			t.Errorf("comicMangaByRegion(%d, %q) = %q, want %q", tt.bookInfo.Region, tt.bookInfo.RegionName, got, tt.want)
+		}
+		if got := tt.bookInfo.rightToLeft(); got != (tt.want == "YesAndRightToLeft") {
+			t.Errorf("rightToLeft(%d, %q) = %v", tt.bookInfo.Region, tt.bookInfo.RegionName, got)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// zip 和 cbz 中图片的压缩方式, 元数据始终使用 deflate
+const (
+	CompressionStore   = "store"
+	CompressionDeflate = "deflate" // 可写为 deflate-1 到 deflate-9 指定压缩级别
+)
+
+// parseCompression 返回图片使用的压缩方法和 deflate 级别, 无效的值按 store 处理
+func parseCompression(compression string) (uint16, int) {
+	if compression == CompressionDeflate {
+		return zip.Deflate, flate.DefaultCompression
+	}
+	if level, ok := strings.CutPrefix(compression, CompressionDeflate+"-"); ok {
+		if n, err := strconv.Atoi(level); err == nil && n >= flate.BestSpeed && n <= flate.BestCompression {
+			return zip.Deflate, n
+		}
+	}
+	return zip.Store, flate.DefaultCompression
+}
+
+// newZipWriter 创建使用指定 deflate 级别的 zip.Writer
+func newZipWriter(w io.Writer, level int) *zip.Writer {
+	zipWriter := zip.NewWriter(w)
+	zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
+	return zipWriter
+}
+
+// createZipEntry 按文件类型选择压缩方法, 图片使用 imageMethod, 其他文件使用 deflate
+func createZipEntry(zipWriter *zip.Writer, name string, imageMethod uint16) (io.Writer, error) {
+	method := uint16(zip.Deflate)
+	if isImageName(name) {
+		method = imageMethod
+	}
+	return zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+}
+
+// CreateTarFromDirectory 把目录打包为不压缩的 tar, 用于 cbt
+func CreateTarFromDirectory(sourceDir, tarPath string) error {
+	return atomicWriteFile(tarPath, func(tarFile *os.File) error {
+		tarWriter := tar.NewWriter(tarFile)
+
+		err := filepath.Walk(sourceDir, func(file string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// 跳过目录本身和未完成的临时文件
+			if fi.IsDir() || isTempFile(file) {
+				return nil
+			}
+
+			relPath, err := filepath.Rel(sourceDir, file)
+			if err != nil {
+				return err
+			}
+			header, err := tar.FileInfoHeader(fi, "")
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(relPath)
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+
+			fileReader, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer fileReader.Close()
+
+			_, err = io.Copy(tarWriter, fileReader)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		return tarWriter.Close()
+	})
+}
+
+// archiveEntry tar 包中的单个文件
+type archiveEntry struct {
+	Name string
+	Data []byte
+}
+
+// readTarEntries 读取 tar 包中的所有文件, 文件截断时返回错误
+func readTarEntries(file string) ([]archiveEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []archiveEntry
+	reader := tar.NewReader(f)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", header.Name, err)
+		}
+		entries = append(entries, archiveEntry{Name: header.Name, Data: data})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+//go:embed all:frontend/dist
+var assets embed.FS
+
+//go:embed frontend/shim/wails-http.js
+var wailsShim []byte
+
+// bindingOverrides 浏览器中不能直接调用的绑定方法
+var bindingOverrides = map[string]func(args []json.RawMessage) (interface{}, error){
+	// 不返回账号和访问令牌
+	"main.Config.GetConfig": func([]json.RawMessage) (interface{}, error) {
+		return publicConfig(), nil
+	},
+	// 不允许修改输出目录
+	"main.Config.SaveConfig": func(args []json.RawMessage) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("SaveConfig expects 1 arguments, got %d", len(args))
+		}
+		var config Config
+		if err := json.Unmarshal(args[0], &config); err != nil {
+			return nil, err
+		}
+		return nil, saveRemoteConfig(&config)
+	},
+}
+
+// allowedBindings 浏览器中可以调用的绑定方法, 只开放前端页面用到的方法.
+// 其余导出方法 (例如读取服务器本地文件的 PreviewImport) 不通过 HTTP 开放
+var allowedBindings = map[string]bool{
+	"main.Config.GetConfig":                     true,
+	"main.Config.Save":                          true,
+	"main.Config.SaveConfig":                    true,
+	"main.Config.SetSeriesOption":               true,
+	"main.DownloaderManager.ApplyImport":        true,
+	"main.DownloaderManager.BuildOmnibus":       true,
+	"main.DownloaderManager.ClearDownloaders":   true,
+	"main.DownloaderManager.DownloadBundle":     true,
+	"main.DownloaderManager.DownloadList":       true,
+	"main.DownloaderManager.GetBookInfo":        true,
+	"main.DownloaderManager.GetComicChapter":    true,
+	"main.DownloaderManager.GetDownloader":      true,
+	"main.DownloaderManager.GetDownloaders":     true,
+	"main.DownloaderManager.GetSchedulerState":  true,
+	"main.DownloaderManager.PreviewImportText":  true,
+	"main.DownloaderManager.ScanLibrary":        true,
+	"main.DownloaderManager.Search":             true,
+	"main.DownloaderManager.SelectChapters":     true,
+	"main.DownloaderManager.SetComicNotBefore":  true,
+	"main.DownloaderManager.SetTaskNotBefore":   true,
+	"main.DownloaderManager.VerifyLibrary":      true,
+	"main.Library.GetChapters":                  true,
+	"main.Library.GetSeries":                    true,
+	"main.SubscriptionManager.CheckNow":         true,
+	"main.SubscriptionManager.GetSubscriptions": true,
+	"main.SubscriptionManager.Subscribe":        true,
+	"main.SubscriptionManager.Unsubscribe":      true,
+}
+
+// bindings 返回与 Wails 绑定相同的对象, 浏览器中所有用户共用同一个 DownloaderManager
+func (s *Server) bindings() map[string]interface{} {
+	return map[string]interface{}{
+		"main.Config":              ConfigInstance,
+		"main.DownloaderManager":   s.manager,
+		"main.SubscriptionManager": s.subscription,
+		"main.Library":             LibraryInstance,
+	}
+}
+
+// handleBinding 调用绑定方法, 请求体为参数数组, 返回值与 Wails 绑定的 Promise 结果相同
+func (s *Server) handleBinding(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var args []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !allowedBindings[name] {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown binding: %s", name))
+		return
+	}
+
+	if override, ok := bindingOverrides[name]; ok {
+		result, err := override(args)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJson(w, result)
+		return
+	}
+
+	dot := strings.LastIndex(name, ".")
+	target, ok := s.bindings()[name[:max(dot, 0)]]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown binding: %s", name))
+		return
+	}
+	result, err := callBinding(target, name[dot+1:], args)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJson(w, result)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// callBinding 按名称调用导出方法, 返回值可以是 (), (T), (error) 或 (T, error)
+func callBinding(target interface{}, methodName string, args []json.RawMessage) (interface{}, error) {
+	method := reflect.ValueOf(target).MethodByName(methodName)
+	if !method.IsValid() {
+		return nil, fmt.Errorf("unknown method: %s", methodName)
+	}
+	methodType := method.Type()
+	if methodType.NumIn() != len(args) {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", methodName, methodType.NumIn(), len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		value := reflect.New(methodType.In(i))
+		if err := json.Unmarshal(arg, value.Interface()); err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i+1, err)
+		}
+		in[i] = value.Elem()
+	}
+
+	var result interface{}
+	for i, out := range method.Call(in) {
+		if methodType.Out(i) == errorType {
+			if !out.IsNil() {
+				return nil, out.Interface().(error)
+			}
+			continue
+		}
+		result = out.Interface()
+	}
+	return result, nil
+}
+
+// uiHandler 提供嵌入的前端页面, 并在 index.html 中注入 wailsjs 的 HTTP 实现
+func uiHandler(ui fs.FS) (http.Handler, error) {
+	index, err := fs.ReadFile(ui, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	shim := []byte(`<script src="/wails-http.js"></script>`)
+	if head := []byte("<head>"); bytes.Contains(index, head) {
+		index = bytes.Replace(index, head, append(head, shim...), 1)
+	} else {
+		index = append(shim, index...)
+	}
+
+	files := http.FileServerFS(ui)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/", "/index.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(index)
+		case "/wails-http.js":
+			w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			w.Write(wailsShim)
+		default:
+			files.ServeHTTP(w, r)
+		}
+	}), nil
+}
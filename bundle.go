@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 合并方式, 与 SelectChapters 的表达式一样以字符串传递
+const (
+	BundleVolume = "volume" // 按单行本分卷
+	BundleChunk  = "chunk"  // 每 N 话合并, 写为 chunk:N
+	BundleManual = "manual" // 选中的章节合并为一个文件
+)
+
+// Bundle 合并为一个文件的多个章节. 每个章节仍作为单独的任务下载到临时目录,
+// 最后一个章节结束后统一打包
+type Bundle struct {
+	Title string
+	// 单行本卷号, 0 表示不是按卷合并或章节名中没有卷号
+	Volume int
+	// 打包后的文件路径
+	path   string
+	config *Config
+	tasks  []*DownloaderSingle
+
+	mu        sync.Mutex
+	remaining int
+	// 下载失败的章节名
+	failed []string
+}
+
+// bundleGroup 合并到同一个文件的章节
+type bundleGroup struct {
+	title   string
+	volume  int
+	indexes []int
+}
+
+var volumePattern = regexp.MustCompile(`第\s*(\d+)\s*[卷巻册冊]|(?i)\bvol(?:ume)?\.?\s*(\d+)`)
+
+// chapterVolume 从章节名中解析卷号, 没有卷号时返回 0
+func chapterVolume(name string) int {
+	match := volumePattern.FindStringSubmatch(name)
+	if match == nil {
+		return 0
+	}
+	volume, _ := strconv.Atoi(match[1] + match[2])
+	return volume
+}
+
+// groupBundles 按合并方式把选中的章节分组.
+// volume 按章节名中的卷号分组, 连续的没有卷号的章节单独成组, 选中的章节都没有卷号时返回错误;
+// chunk:N 每 N 个章节一组; manual 全部合为一组
+func groupBundles(chapters []*ChapterInfo, indexes []int, spec string) ([]bundleGroup, error) {
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("没有选中章节")
+	}
+	indexes = slices.Clone(indexes)
+	slices.Sort(indexes)
+	mode, arg, _ := strings.Cut(spec, ":")
+
+	var groups []bundleGroup
+	switch mode {
+	case BundleVolume:
+		numbered := false
+		for _, index := range indexes {
+			volume := chapterVolume(chapters[index].Name)
+			numbered = numbered || volume != 0
+			if len(groups) == 0 || volume != groups[len(groups)-1].volume {
+				groups = append(groups, bundleGroup{volume: volume})
+			}
+			last := &groups[len(groups)-1]
+			last.indexes = append(last.indexes, index)
+		}
+		// 按话连载的章节名中没有卷号, 不能按卷合并
+		if !numbered {
+			return nil, fmt.Errorf("选中的章节名中没有卷号, 请按话数或手动合并")
+		}
+	case BundleChunk:
+		size, err := strconv.Atoi(arg)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid chunk size: %q", arg)
+		}
+		for start := 0; start < len(indexes); start += size {
+			end := min(start+size, len(indexes))
+			groups = append(groups, bundleGroup{indexes: indexes[start:end]})
+		}
+	case BundleManual:
+		groups = append(groups, bundleGroup{indexes: indexes})
+	default:
+		return nil, fmt.Errorf("unknown bundle mode: %q", spec)
+	}
+
+	for i := range groups {
+		group := &groups[i]
+		first := chapters[group.indexes[0]].Name
+		last := chapters[group.indexes[len(group.indexes)-1]].Name
+		switch {
+		case group.volume > 0:
+			group.title = fmt.Sprintf("第%02d卷", group.volume)
+		case first == last:
+			group.title = first
+		default:
+			group.title = first + " - " + last
+		}
+	}
+	return groups, nil
+}
+
+// newBundles 为选中的章节创建合并任务, 只支持打包为单个文件的格式
+func (d *Downloader) newBundles(indexes []int, spec string) ([]*DownloaderSingle, error) {
+	ext := packageExt(d.config.PackageType)
+	if ext == "" {
+		return nil, fmt.Errorf("合并下载不支持 %s 格式", d.config.PackageType)
+	}
+	groups, err := groupBundles(d.ChapterList, indexes, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []*DownloaderSingle
+	for _, group := range groups {
+		bundle := &Bundle{
+			Title:     group.title,
+			Volume:    group.volume,
+			path:      filepath.Join(d.config.OutputPath, d.bookInfo.Series, sanitizeFilename(group.title)+ext),
+			config:    d.config,
+			remaining: len(group.indexes),
+		}
+		for _, task := range d.GetDownloadList(group.indexes) {
+			task.bundle = bundle
+			bundle.tasks = append(bundle.tasks, task)
+		}
+		tasks = append(tasks, bundle.tasks...)
+	}
+	return tasks, nil
+}
+
+// queueBundle 把漫画中按表达式选中的章节合并下载, 返回加入的任务数
+func (d *DownloaderManager) queueBundle(pathWord string, selection string, packageType string, spec string) (int, error) {
+	config := ConfigInstance.withOverrides(packageType, "")
+	downloader := NewDownloader(ConfigInstance.UrlBase, pathWord, config)
+	indexes, err := downloader.Select(selection)
+	if err != nil {
+		return 0, err
+	}
+	tasks, err := downloader.newBundles(indexes, spec)
+	if err != nil {
+		return 0, err
+	}
+	d.enqueue(tasks)
+	return len(tasks), nil
+}
+
+// dir 合并前存放各章节图片的临时目录
+func (b *Bundle) dir() string {
+	return trimPackageExt(b.path)
+}
+
+// chapterDir 返回章节在临时目录中的子目录, 按章节在合并文件中的顺序编号
+func (b *Bundle) chapterDir(task *DownloaderSingle) string {
+	for i, t := range b.tasks {
+		if t == task {
+			return filepath.Join(b.dir(), fmt.Sprintf("%03d", i+1))
+		}
+	}
+	return filepath.Join(b.dir(), task.Chapter.UUID)
+}
+
+// taskDone 在章节任务结束时调用, 最后一个章节结束后打包. 返回值作为该任务的结果
+func (b *Bundle) taskDone(task *DownloaderSingle, err error) error {
+	b.mu.Lock()
+	b.remaining--
+	if err != nil {
+		b.failed = append(b.failed, task.Chapter.Name)
+	}
+	last, failed := b.remaining == 0, slices.Clone(b.failed)
+	b.mu.Unlock()
+
+	if !last {
+		return err
+	}
+	// 最后一个章节成功时也要报告之前失败的章节, 否则合并文件会被悄悄跳过
+	if len(failed) > 0 {
+		os.RemoveAll(b.dir())
+		return fmt.Errorf("%s 未生成, 下载失败的章节: %s", b.Title, strings.Join(failed, ", "))
+	}
+	return b.build()
+}
+
+func (b *Bundle) build() error {
+	pageCount := 0
+	for _, task := range b.tasks {
+		pageCount += len(task.pages)
+	}
+
+	err := buildVersioned(b.path, b.config.versionRetention(), func(tmpPath string) error {
+		var err error
+		switch b.config.PackageType {
+		case "cbz", "cbt", "zip":
+			err = b.buildArchive(tmpPath)
+		case "epub", "kepub":
+			err = b.buildEpub(tmpPath)
+		case "pdf":
+			err = b.buildPdf(tmpPath)
+		case "mobi", "azw3":
+			err = b.buildMobi(tmpPath)
+		}
+		if err != nil {
+			return err
+		}
+		if err := validatePackage(tmpPath, b.config.PackageType); err != nil {
+			return fmt.Errorf("%s: %v", b.path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	os.RemoveAll(b.dir())
+
+	if err := LibraryInstance.recordBundle(b, pageCount); err != nil {
+		fmt.Fprintln(logOutput, "Error updating library:", err)
+	}
+	return nil
+}
+
+// buildArchive 把各章节的图片按顺序重新编号到同一目录后打包,
+// cbz 和 cbt 的 ComicInfo 在每个章节的第一页记录书签
+func (b *Bundle) buildArchive(path string) error {
+	dir := b.dir()
+	var pages []PageInfo
+	bookmarks := make(map[int]string)
+	for _, task := range b.tasks {
+		chapterDir := b.chapterDir(task)
+		bookmarks[len(pages)] = task.Chapter.Name
+		for _, page := range task.pages {
+			name := fmt.Sprintf("%04d%s", len(pages)+1, filepath.Ext(page.Name))
+			if err := os.Rename(filepath.Join(chapterDir, page.Name), filepath.Join(dir, name)); err != nil {
+				return err
+			}
+			page.Name = name
+			pages = append(pages, page)
+		}
+		os.RemoveAll(chapterDir)
+	}
+
+	switch b.config.PackageType {
+	case "cbz":
+		comicInfo := b.comicInfo(pages, bookmarks)
+		if err := comicInfo.Build(dir); err != nil {
+			return err
+		}
+		return CreateZipFromDirectory(dir, path, b.config.Compression)
+	case "cbt":
+		comicInfo := b.comicInfo(pages, bookmarks)
+		if err := comicInfo.Build(dir); err != nil {
+			return err
+		}
+		return CreateTarFromDirectory(dir, path)
+	}
+	return CreateZipFromDirectory(dir, path, b.config.Compression)
+}
+
+// identity 返回写入文件元数据的标识, 包含合并的所有章节
+func (b *Bundle) identity() string {
+	first := b.tasks[0]
+	uuids := make([]string, len(b.tasks))
+	for i, task := range b.tasks {
+		uuids[i] = task.Chapter.UUID
+	}
+	return fileIdentity(first.PathWord, first.BookInfo.UUID, uuids)
+}
+
+// comicInfo 以第一个章节的信息为基础, 标题和卷号取自合并文件
+func (b *Bundle) comicInfo(pages []PageInfo, bookmarks map[int]string) ComicInfo {
+	first := b.tasks[0]
+	comicInfo := NewComicInfo(first, pages)
+	comicInfo.Title = b.Title
+	comicInfo.Number = ""
+	comicInfo.Count = 0
+	comicInfo.Volume = b.Volume
+	comicInfo.Web = fmt.Sprintf("https://%s/comic/%s", first.urlBase, first.PathWord)
+	comicInfo.Notes = b.identity()
+
+	if comicInfo.Pages != nil {
+		for i := range comicInfo.Pages.Page {
+			comicInfo.Pages.Page[i].Bookmark = bookmarks[i]
+		}
+	}
+	return comicInfo
+}
+
+func (b *Bundle) buildEpub(path string) error {
+	first := b.tasks[0]
+	author, description, series := first.BookInfo.Author, first.BookInfo.Description, first.BookInfo.Series
+	var index *int
+	if b.Volume > 0 {
+		index = &b.Volume
+	}
+	// 用漫画和所含章节的 UUID 生成标识, 同一卷重新打包时不变
+	parts := []string{first.BookInfo.UUID}
+	for _, task := range b.tasks {
+		parts = append(parts, task.Chapter.UUID)
+	}
+	identifier := "urn:uuid:" + stableUUID(parts...)
+	metadata := NewMetaData(fmt.Sprintf("%s %s", series, b.Title), &author, nil, &description, &series,
+		strings.Split(first.BookInfo.Genre, ", "), nil, index, &identifier)
+
+	var chapters []ComicChapter
+	for _, task := range b.tasks {
+		chapters = append(chapters, ComicChapter{Title: task.Chapter.Name, ImgPath: b.chapterDir(task)})
+	}
+	epubBuilder := EpubBuilder{
+		metadata: metadata,
+		rtl:      first.BookInfo.rightToLeft(),
+		kobo:     b.config.PackageType == "kepub",
+		identity: b.identity(),
+	}
+	return epubBuilder.BuildComicChapters(path, chapters)
+}
+
+func (b *Bundle) buildPdf(path string) error {
+	first := b.tasks[0]
+	pdfBuilder := PdfBuilder{
+		Title:    fmt.Sprintf("%s - %s", first.BookInfo.Series, b.Title),
+		Author:   first.BookInfo.Author,
+		Subject:  first.BookInfo.Description,
+		Keywords: first.BookInfo.Genre,
+		Identity: b.identity(),
+	}
+	for _, task := range b.tasks {
+		if err := pdfBuilder.AddChapter(task.Chapter.Name, b.chapterDir(task)); err != nil {
+			return err
+		}
+	}
+	return pdfBuilder.Build(path)
+}
+
+func (b *Bundle) buildMobi(path string) error {
+	first := b.tasks[0]
+	mobiBuilder := first.mobiBuilder(fmt.Sprintf("%s %s", first.BookInfo.Series, b.Title))
+	mobiBuilder.Source = fmt.Sprintf("https://%s/comic/%s", first.urlBase, first.PathWord)
+	mobiBuilder.Identity = b.identity()
+	for _, task := range b.tasks {
+		if err := mobiBuilder.AddChapter(task.Chapter.Name, b.chapterDir(task)); err != nil {
+			return err
+		}
+	}
+	return mobiBuilder.Build(path)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupBundlesByVolume(t *testing.T) {
+	chapters := []*ChapterInfo{
+		{Name: "第1卷"}, {Name: "第2卷"}, {Name: "番外1"}, {Name: "番外2"}, {Name: "第3卷"},
+	}
+	groups, err := groupBundles(chapters, []int{4, 0, 1, 2, 3}, BundleVolume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	var indexes [][]int
+	for _, group := range groups {
+		titles = append(titles, group.title)
+		indexes = append(indexes, group.indexes)
+	}
+	// 没有卷号的章节单独成组, 不归入前一卷
+	wantTitles := []string{"第01卷", "第02卷", "番外1 - 番外2", "第03卷"}
+	wantIndexes := [][]int{{0}, {1}, {2, 3}, {4}}
+	if !reflect.DeepEqual(titles, wantTitles) || !reflect.DeepEqual(indexes, wantIndexes) {
+		t.Errorf("groups = %q %v, want %q %v", titles, indexes, wantTitles, wantIndexes)
+	}
+}
+
+func TestGroupBundlesWithoutVolumes(t *testing.T) {
+	chapters := []*ChapterInfo{{Name: "第1话"}, {Name: "第2话"}}
+	if _, err := groupBundles(chapters, []int{0, 1}, BundleVolume); err == nil {
+		t.Error("volume mode accepted chapters without volume numbers")
+	}
+	groups, err := groupBundles(chapters, []int{0, 1}, BundleChunk+":1")
+	if err != nil || len(groups) != 2 {
+		t.Errorf("chunk:1 = %v, %v", groups, err)
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 命令行退出码
+const (
+	exitOK      = 0
+	exitError   = 1
+	exitUsage   = 2
+	exitPartial = 3 // 部分章节下载失败
+)
+
+const cliUsage = `用法: copymanga-downloader <命令> [参数] [--json]
+
+命令:
+  search <关键字> [--page=1]                 搜索漫画
+  info <漫画>                                显示漫画信息
+  chapters <漫画> [选择表达式]               列出章节
+  download <漫画或章节> [选择表达式] [--format=cbz] [--bundle=volume|chunk:N|manual]
+                                             下载章节并等待完成, --bundle 把章节合并为单个文件
+  omnibus <漫画>                             把本地已下载的章节合并为一本 EPUB
+  queue <列表文件>                           按 txt/csv/json 列表批量下载
+  accounts [list | add [用户名 密码] | remove <用户名>]
+                                             管理下载用的账号
+  serve [--addr=:8080] [--token=...] [--no-ui]
+                                             以 HTTP 接口提供服务, 同时可在浏览器中打开界面,
+                                             令牌默认取配置中的 serverToken
+
+<漫画> 可以是 path word、网址或分享链接. 选择表达式的语法见 SelectChapters, 默认为 all.
+--json 输出 JSON, 下载进度为每行一个事件, 与界面收到的事件相同.`
+
+// cliCommands 命令行模式支持的命令, 参数不是这些命令时启动图形界面
+var cliCommands = map[string]func(c *cli, args []string) int{
+	"search":   (*cli).search,
+	"info":     (*cli).info,
+	"chapters": (*cli).chapters,
+	"download": (*cli).download,
+	"queue":    (*cli).queue,
+	"omnibus":  (*cli).omnibus,
+	"accounts": (*cli).accounts,
+	"serve":    (*cli).serve,
+	"help":     (*cli).help,
+}
+
+type cli struct {
+	out   io.Writer
+	json  bool
+	flags map[string]string
+}
+
+// runCli 以命令行模式运行, 第一个参数不是已知命令时返回 false
+func runCli(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	command, ok := cliCommands[args[0]]
+	if !ok {
+		return 0, false
+	}
+
+	// 下载过程中的日志输出到 stderr, stdout 只保留命令结果
+	c := &cli{out: os.Stdout}
+	logOutput = os.Stderr
+	positional, flags := parseCliArgs(args[1:])
+	c.flags = flags
+	_, c.json = flags["json"]
+	return command(c, positional), true
+}
+
+// parseCliArgs 拆分位置参数和 --key=value 形式的选项
+func parseCliArgs(args []string) ([]string, map[string]string) {
+	var positional []string
+	flags := make(map[string]string)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			positional = append(positional, arg)
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		flags[key] = value
+	}
+	return positional, flags
+}
+
+func (c *cli) print(v interface{}, text func(w io.Writer)) {
+	if c.json {
+		encoder := json.NewEncoder(c.out)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(v)
+		return
+	}
+	text(c.out)
+}
+
+func (c *cli) fail(err error) int {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	return exitError
+}
+
+func (c *cli) usage() int {
+	fmt.Fprintln(os.Stderr, cliUsage)
+	return exitUsage
+}
+
+func (c *cli) help(args []string) int {
+	fmt.Fprintln(c.out, cliUsage)
+	return exitOK
+}
+
+func (c *cli) search(args []string) int {
+	if len(args) == 0 {
+		return c.usage()
+	}
+	page := 1
+	if value, ok := c.flags["page"]; ok {
+		var err error
+		if page, err = strconv.Atoi(value); err != nil || page < 1 {
+			return c.usage()
+		}
+	}
+	comics, err := Search(ConfigInstance.UrlBase, strings.Join(args, " "), page)
+	if err != nil {
+		return c.fail(err)
+	}
+	c.print(comics, func(w io.Writer) {
+		for _, comic := range comics {
+			var authors []string
+			for _, author := range comic.Author {
+				authors = append(authors, author.Name)
+			}
+			fmt.Fprintf(w, "%-30s %s  %s\n", comic.PathWord, comic.Name, strings.Join(authors, ", "))
+		}
+	})
+	return exitOK
+}
+
+// openDownloader 解析输入并获取漫画信息和章节列表
+func (c *cli) openDownloader(input string, selection string) (*Downloader, []int, error) {
+	resolved, err := ResolveInput(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	downloader := NewDownloader(ConfigInstance.UrlBase, resolved.PathWord, ConfigInstance)
+	indexes, err := downloader.Select(selection)
+	if err != nil {
+		return nil, nil, err
+	}
+	return downloader, indexes, nil
+}
+
+func (c *cli) info(args []string) int {
+	if len(args) != 1 {
+		return c.usage()
+	}
+	downloader, _, err := c.openDownloader(args[0], "")
+	if err != nil {
+		return c.fail(err)
+	}
+	local := 0
+	for _, chapter := range downloader.ChapterList {
+		if chapter.Local {
+			local++
+		}
+	}
+	info := struct {
+		PathWord string    `json:"pathWord"`
+		BookInfo *BookInfo `json:"bookInfo"`
+		Chapters int       `json:"chapters"`
+		Local    int       `json:"local"`
+	}{downloader.pathWord, downloader.bookInfo, len(downloader.ChapterList), local}
+	c.print(info, func(w io.Writer) {
+		fmt.Fprintln(w, "标题:", info.BookInfo.Series)
+		fmt.Fprintln(w, "作者:", info.BookInfo.Author)
+		fmt.Fprintln(w, "题材:", info.BookInfo.Genre)
+		fmt.Fprintln(w, "章节:", info.Chapters, "已下载:", info.Local)
+		fmt.Fprintln(w, "封面:", info.BookInfo.Cover)
+		fmt.Fprintln(w, info.BookInfo.Description)
+	})
+	return exitOK
+}
+
+func (c *cli) chapters(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		return c.usage()
+	}
+	selection := ""
+	if len(args) == 2 {
+		selection = args[1]
+	}
+	downloader, indexes, err := c.openDownloader(args[0], selection)
+	if err != nil {
+		return c.fail(err)
+	}
+	chapters := make([]*ChapterInfo, 0, len(indexes))
+	for _, i := range indexes {
+		chapters = append(chapters, downloader.ChapterList[i])
+	}
+	c.print(chapters, func(w io.Writer) {
+		for _, i := range indexes {
+			chapter := downloader.ChapterList[i]
+			local := ""
+			if chapter.Local {
+				local = " (已下载)"
+			}
+			fmt.Fprintf(w, "%4d  %s  %-10s %s%s\n", i+1, chapter.UUID, chapter.DatetimeCreated, chapter.Name, local)
+		}
+	})
+	return exitOK
+}
+
+func (c *cli) download(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		return c.usage()
+	}
+	format := c.flags["format"]
+	if format != "" && !isPackageType(format) {
+		return c.usage()
+	}
+	selection := ""
+	if len(args) == 2 {
+		selection = args[1]
+	}
+	resolved, err := ResolveInput(args[0])
+	if err != nil {
+		return c.fail(err)
+	}
+
+	if bundle := c.flags["bundle"]; bundle != "" {
+		if resolved.ChapterUUID != "" {
+			return c.usage()
+		}
+		return c.runDownloads(func(manager *DownloaderManager) (int, error) {
+			_, err := manager.queueBundle(resolved.PathWord, selection, format, bundle)
+			return 0, err
+		})
+	}
+	return c.runDownloads(func(manager *DownloaderManager) (int, error) {
+		_, err := manager.queueInput(resolved.PathWord, resolved.ChapterUUID, selection, format)
+		return 0, err
+	})
+}
+
+func (c *cli) omnibus(args []string) int {
+	if len(args) != 1 {
+		return c.usage()
+	}
+	downloader, _, err := c.openDownloader(args[0], "")
+	if err != nil {
+		return c.fail(err)
+	}
+	path, err := buildOmnibus(downloader)
+	if err != nil {
+		return c.fail(err)
+	}
+	c.print(struct {
+		Path string `json:"path"`
+	}{path}, func(w io.Writer) {
+		fmt.Fprintln(w, path)
+	})
+	return exitOK
+}
+
+func (c *cli) queue(args []string) int {
+	if len(args) != 1 {
+		return c.usage()
+	}
+	return c.runDownloads(func(manager *DownloaderManager) (int, error) {
+		entries, err := manager.PreviewImport(args[0])
+		if err != nil {
+			return 0, err
+		}
+		skipped := 0
+		for _, entry := range entries {
+			if entry.Status != ImportReady {
+				skipped++
+				fmt.Fprintf(os.Stderr, "line %d: skipped %s: %s%s\n", entry.Line, entry.Input, entry.Status, entryError(entry))
+			}
+		}
+		result := manager.ApplyImport(entries)
+		for _, entry := range result.Failed {
+			fmt.Fprintf(os.Stderr, "line %d: failed %s%s\n", entry.Line, entry.Input, entryError(entry))
+		}
+		return skipped + len(result.Failed), nil
+	})
+}
+
+func entryError(entry *ImportEntry) string {
+	if entry.Error == "" {
+		return ""
+	}
+	return ": " + entry.Error
+}
+
+// runDownloads 启动调度器, 通过 queue 加入任务后等待全部完成并输出进度.
+// queue 返回没能加入队列的条目数, 计入失败
+func (c *cli) runDownloads(queue func(manager *DownloaderManager) (int, error)) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	total, failed := 0, 0
+	manager := &DownloaderManager{downloaders: make([]*DownloaderSingle, 0, 200), ignoreSchedule: true}
+	manager.onTaskDone(func(task *DownloaderSingle, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		total++
+		if err != nil {
+			failed++
+		}
+	})
+	progress := newCliProgress(c)
+	manager.start(ctx, progress.emit)
+
+	rejected, err := queue(manager)
+	if err != nil {
+		return c.fail(err)
+	}
+	for manager.scheduler.Pending() > 0 {
+		time.Sleep(500 * time.Millisecond)
+	}
+	manager.emitter.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	total += rejected
+	failed += rejected
+	summary := struct {
+		Event  string `json:"event"`
+		Total  int    `json:"total"`
+		Failed int    `json:"failed"`
+	}{"done", total, failed}
+	c.print(summary, func(w io.Writer) {
+		fmt.Fprintf(w, "完成 %d 个章节, 失败 %d 个\n", total-failed, failed)
+	})
+	if failed > 0 && failed == total {
+		return exitError
+	}
+	if failed > 0 {
+		return exitPartial
+	}
+	return exitOK
+}
+
+// cliProgress 输出下载进度, 文本模式下只在状态变化或进度前进 10% 时输出
+type cliProgress struct {
+	c    *cli
+	mu   sync.Mutex
+	last map[int64]string
+}
+
+func newCliProgress(c *cli) *cliProgress {
+	return &cliProgress{c: c, last: make(map[int64]string)}
+}
+
+func (p *cliProgress) emit(eventName string, data ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.c.json {
+		event := struct {
+			Event string      `json:"event"`
+			Data  interface{} `json:"data"`
+		}{Event: eventName}
+		if len(data) > 0 {
+			event.Data = data[0]
+		}
+		p.c.print(event, nil)
+		return
+	}
+
+	if len(data) == 0 {
+		return
+	}
+	tasks, ok := data[0].([]*DownloaderSingle)
+	if !ok {
+		return
+	}
+	for _, task := range tasks {
+		state := task.getState()
+		progress := task.GetProgress()
+		key := fmt.Sprintf("%s %d", state, int(progress)/10)
+		if p.last[task.ID] == key {
+			continue
+		}
+		p.last[task.ID] = key
+		fmt.Fprintf(p.c.out, "[%-7s] %3.0f%%  %s %s\n", state, progress, task.BookInfo.Series, task.Chapter.Name)
+	}
+}
+
+func (c *cli) accounts(args []string) int {
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "list":
+	case "add":
+		user := &User{}
+		switch len(args) {
+		case 1:
+			if err := Register(user); err != nil {
+				return c.fail(err)
+			}
+		case 3:
+			user.Username, user.Password = args[1], args[2]
+		default:
+			return c.usage()
+		}
+		if err := Login(user); err != nil {
+			return c.fail(err)
+		}
+		if user.Token == "" {
+			return c.fail(fmt.Errorf("登录失败: %s", user.Username))
+		}
+		ConfigInstance.UserList = append(ConfigInstance.UserList, user)
+		ConfigInstance.Save()
+	case "remove":
+		if len(args) != 2 {
+			return c.usage()
+		}
+		users := ConfigInstance.UserList[:0]
+		found := false
+		for _, user := range ConfigInstance.UserList {
+			if user.Username == args[1] {
+				found = true
+				continue
+			}
+			users = append(users, user)
+		}
+		if !found {
+			return c.fail(fmt.Errorf("没有找到账号: %s", args[1]))
+		}
+		ConfigInstance.UserList = users
+		ConfigInstance.Save()
+	default:
+		return c.usage()
+	}
+
+	type account struct {
+		Username string `json:"username"`
+		LoggedIn bool   `json:"loggedIn"`
+	}
+	accounts := make([]account, 0, len(ConfigInstance.UserList))
+	for _, user := range ConfigInstance.UserList {
+		accounts = append(accounts, account{user.Username, user.Token != ""})
+	}
+	c.print(accounts, func(w io.Writer) {
+		for _, account := range accounts {
+			status := "未登录"
+			if account.LoggedIn {
+				status = "已登录"
+			}
+			fmt.Fprintf(w, "%-20s %s\n", account.Username, status)
+		}
+	})
+	return exitOK
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +13,31 @@ type Config struct {
 	PackageType string  `json:"packageType"`
 	UserList    []*User `json:"userList"`
 	NamingStyle string  `json:"namingStyle"`
+	// 进度事件的最小发送间隔, 单位毫秒
+	ProgressInterval int `json:"progressInterval"`
+	// 图片校验模式: magic, header, full, 默认 header
+	ImageCheck string `json:"imageCheck"`
+	// 图片分辨率: original, c1500x, c800x
+	ImageQuality string `json:"imageQuality"`
+	PreferWebp   bool   `json:"preferWebp"`
+	// 按 path word 设置的单部漫画配置
+	SeriesOptions map[string]*SeriesOption `json:"seriesOptions"`
+	// 下载时间窗口
+	Schedule *ScheduleConfig `json:"schedule"`
+	// 订阅检查间隔, 单位分钟
+	SubscriptionInterval int `json:"subscriptionInterval"`
+	// 覆盖旧文件时保留的历史版本数, 0 使用默认值, 负数表示不保留
+	VersionRetention int `json:"versionRetention"`
+	// zip 和 cbz 中图片的压缩方式: store, deflate 或 deflate-1 到 deflate-9, 默认 store
+	Compression string `json:"compression"`
+	// 服务器模式的访问令牌, 为空时首次启动自动生成
+	ServerToken string `json:"serverToken"`
+}
+
+// SeriesOption 单部漫画的配置, 未设置的字段沿用全局配置
+type SeriesOption struct {
+	ImageQuality string `json:"imageQuality"`
+	PreferWebp   *bool  `json:"preferWebp"`
 }
 
 type User struct {
@@ -37,7 +63,7 @@ func Load() *Config {
 	var config *Config = &Config{}
 	err = json.Unmarshal(content, config)
 	if err != nil {
-		fmt.Println("Error deserializing config:", err)
+		fmt.Fprintln(logOutput, "Error deserializing config:", err)
 		return &Config{
 			UrlBase:     "mangacopy.com",
 			OutputPath:  "./",
@@ -53,19 +79,103 @@ func Load() *Config {
 func (c *Config) Save() {
 	content, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
-		fmt.Println("Error serializing config:", err)
+		fmt.Fprintln(logOutput, "Error serializing config:", err)
 		return
 	}
 
-	err = os.WriteFile("config.json", content, 0644)
+	err = atomicWriteFile("config.json", func(f *os.File) error {
+		_, err := f.Write(content)
+		return err
+	})
 	if err != nil {
-		fmt.Println("Error writing config file:", err)
+		fmt.Fprintln(logOutput, "Error writing config file:", err)
+	}
+}
+
+func (c *Config) progressInterval() time.Duration {
+	if c.ProgressInterval <= 0 {
+		return 200 * time.Millisecond
+	}
+	return time.Duration(c.ProgressInterval) * time.Millisecond
+}
+
+func (c *Config) imageCheckMode() string {
+	switch c.ImageCheck {
+	case ImageCheckMagic, ImageCheckFull:
+		return c.ImageCheck
+	default:
+		// 检查文件结尾的开销很小, 默认即可发现被截断的图片
+		return ImageCheckHeader
 	}
 }
 
+// imageOptions 返回 pathWord 对应漫画实际使用的分辨率和 WebP 偏好
+func (c *Config) imageOptions(pathWord string) (string, bool) {
+	quality := c.ImageQuality
+	preferWebp := c.PreferWebp
+	if option, ok := c.SeriesOptions[pathWord]; ok {
+		if option.ImageQuality != "" {
+			quality = option.ImageQuality
+		}
+		if option.PreferWebp != nil {
+			preferWebp = *option.PreferWebp
+		}
+	}
+	if quality == "" {
+		quality = ImageQualityC1500
+	}
+	return quality, preferWebp
+}
+
+func (c *Config) subscriptionInterval() time.Duration {
+	if c.SubscriptionInterval <= 0 {
+		return 60 * time.Minute
+	}
+	return time.Duration(c.SubscriptionInterval) * time.Minute
+}
+
+func (c *Config) versionRetention() int {
+	if c.VersionRetention == 0 {
+		return 3
+	}
+	return c.VersionRetention
+}
+
+// withOverrides 返回覆盖了打包方式和命名风格的配置副本, 空字符串表示沿用原配置
+func (c *Config) withOverrides(packageType string, namingStyle string) *Config {
+	config := *c
+	if packageType != "" {
+		config.PackageType = packageType
+	}
+	if namingStyle != "" {
+		config.NamingStyle = namingStyle
+	}
+	return &config
+}
+
+// SetSeriesOption 设置单部漫画的配置, option 为 nil 时恢复全局配置
+func (c *Config) SetSeriesOption(pathWord string, option *SeriesOption) {
+	if option == nil {
+		delete(ConfigInstance.SeriesOptions, pathWord)
+	} else {
+		if ConfigInstance.SeriesOptions == nil {
+			ConfigInstance.SeriesOptions = make(map[string]*SeriesOption)
+		}
+		ConfigInstance.SeriesOptions[pathWord] = option
+	}
+	ConfigInstance.Save()
+}
+
 // SaveConfig  .
 func (c *Config) SaveConfig(config *Config) {
 	config.UserList = ConfigInstance.UserList
+	config.ServerToken = ConfigInstance.ServerToken
+	if config.SeriesOptions == nil {
+		config.SeriesOptions = ConfigInstance.SeriesOptions
+	}
+	if config.Schedule == nil {
+		config.Schedule = ConfigInstance.Schedule
+	}
 	*ConfigInstance = *config
 	ConfigInstance.Save()
 }
@@ -0,0 +1,27 @@
+//go:build !headless
+
+package main
+
+import (
+	"context"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// 依赖 Wails 运行时的方法只在图形界面版本中编译, headless 版本不链接 Wails
+
+func (d *DownloaderManager) startup(ctx context.Context) {
+	d.start(ctx, func(eventName string, data ...interface{}) {
+		runtime.EventsEmit(ctx, eventName, data...)
+	})
+}
+
+// SelectImportFile 打开文件选择框, 返回选中的导入文件路径
+func (d *DownloaderManager) SelectImportFile() (string, error) {
+	return runtime.OpenFileDialog(d.ctx, runtime.OpenDialogOptions{
+		Title: "选择导入文件",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "漫画列表 (*.txt;*.csv;*.json)", Pattern: "*.txt;*.csv;*.json"},
+		},
+	})
+}
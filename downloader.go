@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 
@@ -12,17 +13,31 @@ import (
 )
 
 type BookInfo struct {
+	UUID        string
 	Series      string
 	Author      string
 	Description string
 	Genre       string
 	Title       string
 	Cover       string
+	Tags        []string
+	// 地区, 0 日本, 1 韩国, 2 欧美. 零值与日本相同, 以 RegionName 是否为空区分是否已知
+	Region     int
+	RegionName string
+	Finished   bool
+	// 分级, 如 一般向
+	Restrict string
+}
+
+// rightToLeft 判断是否为从右向左翻页的日漫, 地区未知时按从左到右处理
+func (b *BookInfo) rightToLeft() bool {
+	return b.RegionName != "" && b.Region == 0
 }
 
 type Downloader struct {
 	urlBase     string
 	pathWord    string
+	group       string
 	ChapterList []*ChapterInfo
 	bookInfo    *BookInfo
 
@@ -35,8 +50,12 @@ type HeaderRoundTripper struct {
 }
 
 func (h *HeaderRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	// 为每个请求设置请求头
+	// 为每个请求设置请求头, 请求自身已设置的头优先
+	preset := req.Header.Clone()
 	for key, value := range h.Headers {
+		if preset.Get(key) != "" {
+			continue
+		}
 		req.Header.Set(key, value)
 	}
 	// 执行请求并返回响应
@@ -66,6 +85,7 @@ func NewDownloader(urlBase string, pathWord string, config *Config) *Downloader
 	return &Downloader{
 		urlBase:  urlBase,
 		pathWord: pathWord,
+		group:    "default",
 		config:   config,
 		bookInfo: &BookInfo{},
 	}
@@ -74,7 +94,7 @@ func NewDownloader(urlBase string, pathWord string, config *Config) *Downloader
 func Search(urlBase string, keyword string, page int) ([]Comic, error) {
 	limit := 12
 	url := fmt.Sprintf("https://%s/api/v3/search/comic?offset=%d&platform=4&limit=%d&q=%s&q_type=",
-		urlBase, (page-1)*limit, limit, keyword)
+		urlBase, (page-1)*limit, limit, url.QueryEscape(keyword))
 	resp, err := client.Get(url)
 	if err != nil {
 		return nil, err
@@ -97,7 +117,7 @@ func Search(urlBase string, keyword string, page int) ([]Comic, error) {
 }
 
 func (d *Downloader) GetComicChapter() error {
-	url := fmt.Sprintf("https://%s/api/v3/comic/%s/group/default/chapters?limit=500&offset=0", d.urlBase, d.pathWord)
+	url := fmt.Sprintf("https://%s/api/v3/comic/%s/group/%s/chapters?limit=500&offset=0", d.urlBase, d.pathWord, d.group)
 	resp, err := client.Get(url)
 	if err != nil {
 		return err
@@ -137,6 +157,7 @@ func (d *Downloader) GetBookInfo() error {
 	result := gjson.GetBytes(body, "results.comic")
 	var comic Comic
 	json.Unmarshal([]byte(result.Raw), &comic)
+	d.bookInfo.UUID = comic.UUID
 	d.bookInfo.Series = comic.Name
 	var author []string
 	for _, res := range comic.Author {
@@ -149,7 +170,12 @@ func (d *Downloader) GetBookInfo() error {
 	d.bookInfo.Author = strings.Join(author, ", ")
 	d.bookInfo.Description = comic.Brief
 	d.bookInfo.Genre = strings.Join(theme, ", ")
+	d.bookInfo.Tags = theme
 	d.bookInfo.Cover = comic.Cover
+	d.bookInfo.Region = comic.Region.Value
+	d.bookInfo.RegionName = comic.Region.Display
+	d.bookInfo.Finished = comic.Status.Value == 1
+	d.bookInfo.Restrict = comic.Restrict.Display
 	return nil
 }
 
@@ -186,18 +212,74 @@ func (d *Downloader) GetComicInfo() error {
 func (d *Downloader) GetDownloadList(chapters []int) []*DownloaderSingle {
 	var downloaderSinglesList []*DownloaderSingle = make([]*DownloaderSingle, 0, len(chapters))
 	for _, index := range chapters {
-		downloaderSingle := DownloaderSingle{
-			urlBase:  d.urlBase,
-			PathWord: d.pathWord,
-			Chapter:  d.ChapterList[index],
-			BookInfo: d.bookInfo,
-			config:   d.config,
-		}
-		downloaderSinglesList = append(downloaderSinglesList, &downloaderSingle)
+		downloaderSinglesList = append(downloaderSinglesList, d.newTask(d.ChapterList[index]))
 	}
 	return downloaderSinglesList
 }
 
+func (d *Downloader) newTask(chapter *ChapterInfo) *DownloaderSingle {
+	return &DownloaderSingle{
+		ID:       nextTaskID(),
+		urlBase:  d.urlBase,
+		PathWord: d.pathWord,
+		Group:    d.group,
+		Chapter:  chapter,
+		BookInfo: d.bookInfo,
+		config:   d.config,
+	}
+}
+
+// chapterFingerprints 获取章节当前的页面地址并计算指纹
+func (d *Downloader) chapterFingerprints(chapter *ChapterInfo) ([]string, error) {
+	urls, err := d.newTask(chapter).GetImageUrlList(chapter.UUID)
+	if err != nil {
+		return nil, err
+	}
+	return pageFingerprints(urls), nil
+}
+
+// GetChapterInfo 获取单个章节的信息, 不需要先获取整个章节列表
+func (d *Downloader) GetChapterInfo(chapterUUID string) (*ChapterInfo, error) {
+	url := fmt.Sprintf("https://%s/api/v3/comic/%s/chapter2/%s", d.urlBase, d.pathWord, chapterUUID)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := gjson.GetBytes(body, "results.chapter")
+	if !result.Exists() {
+		return nil, fmt.Errorf("没有找到章节: %s", chapterUUID)
+	}
+	var chapter ChapterInfo
+	err = json.Unmarshal([]byte(result.Raw), &chapter)
+	if err != nil {
+		return nil, err
+	}
+	if group := gjson.GetBytes(body, "results.chapter.group_path_word").String(); group != "" {
+		d.group = group
+	}
+	return &chapter, nil
+}
+
+// redownloadTask 为本地已有的章节创建任务, 按原格式打包并覆盖 target
+func (d *Downloader) redownloadTask(chapterUUID string, packageType string, target string) *DownloaderSingle {
+	for i, chapter := range d.ChapterList {
+		if chapter.UUID == chapterUUID {
+			task := d.GetDownloadList([]int{i})[0]
+			task.config = d.config.withOverrides(packageType, "")
+			task.target = target
+			return task
+		}
+	}
+	return nil
+}
+
 func (d *Downloader) DownloadList(chapters []int, processSend func()) error {
 	var wg sync.WaitGroup
 
@@ -210,15 +292,17 @@ func (d *Downloader) DownloadList(chapters []int, processSend func()) error {
 		go func(index int) {
 			defer wg.Done()
 			downloaderSingle := DownloaderSingle{
+				ID:       nextTaskID(),
 				urlBase:  d.urlBase,
 				PathWord: d.pathWord,
+				Group:    d.group,
 				Chapter:  d.ChapterList[index],
 				BookInfo: d.bookInfo,
 				config:   d.config,
 			}
 			err := downloaderSingle.Download(processSend)
 			if err != nil {
-				fmt.Println("Error downloading chapter:", err)
+				fmt.Fprintln(logOutput, "Error downloading chapter:", err)
 			}
 			<-sem
 		}(index)
@@ -228,29 +312,3 @@ func (d *Downloader) DownloadList(chapters []int, processSend func()) error {
 }
 
 var maxConcurrency = 2
-var sem = make(chan struct{}, maxConcurrency)
-var isDownloading = false
-
-func DownloadList(downloaderSingleList chan *DownloaderSingle, processSend func(), clearDownloaders func()) {
-	// if isDownloading {
-	// 	return
-	// }
-	isDownloading = true
-	var wg sync.WaitGroup
-
-	for downloaderSingle := range downloaderSingleList {
-		wg.Add(1)
-		sem <- struct{}{}
-		go func(downloaderSingle *DownloaderSingle) {
-			defer wg.Done()
-			err := downloaderSingle.Download(processSend)
-			if err != nil {
-				fmt.Println("Error downloading chapter:", err)
-			}
-			clearDownloaders()
-			<-sem
-		}(downloaderSingle)
-	}
-	wg.Wait()
-	isDownloading = false
-}
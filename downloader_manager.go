@@ -2,72 +2,285 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"sync"
-
-	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"time"
 )
 
 var muD sync.Mutex
 
 type DownloaderManager struct {
-	ctx             context.Context
-	downloaders     []*DownloaderSingle
-	downloadersChan chan *DownloaderSingle
-	view            *Downloader
+	ctx         context.Context
+	downloaders []*DownloaderSingle
+	view        *Downloader
+	emitter     *progressEmitter
+	scheduler   *Scheduler
+	doneHooks   []func(*DownloaderSingle, error)
+	// 命令行模式一次性下载完就退出, 不等待下载时间窗口
+	ignoreSchedule bool
 }
 
-func (d *DownloaderManager) startup(ctx context.Context) {
+// start 启动事件发送和任务调度, 事件通过 emit 发出. 命令行模式下不经过 Wails 直接调用
+func (d *DownloaderManager) start(ctx context.Context, emit func(eventName string, data ...interface{})) {
 	d.ctx = ctx
-	d.downloadersChan = make(chan *DownloaderSingle, 999)
-	DownloadList(d.downloadersChan, d.ProcessSend, d.ClearDownloaders)
+	d.emitter = newProgressEmitter(emit)
+	d.scheduler = NewScheduler(
+		func() *ScheduleConfig {
+			if d.ignoreSchedule {
+				return nil
+			}
+			return ConfigInstance.Schedule
+		},
+		d.emitter.Updated,
+		func(state SchedulerState) { d.emitter.emit(EventSchedulerState, state) },
+	)
+	go d.emitter.Run(ctx, ConfigInstance.progressInterval)
+	go d.scheduler.Run(ctx, d.runTask)
+}
+
+func (d *DownloaderManager) runTask(downloaderSingle *DownloaderSingle) {
+	err := downloaderSingle.Download(func() { d.emitter.Updated(downloaderSingle) })
+	if downloaderSingle.bundle != nil {
+		err = downloaderSingle.bundle.taskDone(downloaderSingle, err)
+	}
+	if err != nil {
+		fmt.Fprintln(logOutput, "Error downloading chapter:", err)
+		downloaderSingle.setState(TaskStateFailed)
+	} else {
+		downloaderSingle.setState(TaskStateDone)
+	}
+	d.emitter.Updated(downloaderSingle)
+	for _, hook := range d.doneHooks {
+		hook(downloaderSingle, err)
+	}
+	d.ClearDownloaders()
+}
+
+// onTaskDone 注册任务结束时的回调, 需要在 startup 阶段调用
+func (d *DownloaderManager) onTaskDone(hook func(*DownloaderSingle, error)) {
+	d.doneHooks = append(d.doneHooks, hook)
 }
 
 func (d *DownloaderManager) Search(keyword string, page int) ([]Comic, error) {
 	return Search(ConfigInstance.UrlBase, keyword, page)
 }
 
-func (d *DownloaderManager) GetDownloader(pathWord string) {
-	d.view = NewDownloader(ConfigInstance.UrlBase, pathWord, ConfigInstance)
+// GetDownloader 打开漫画, 支持 path word 以及各类网址和分享链接.
+// 输入为章节链接时直接把该章节加入下载队列
+func (d *DownloaderManager) GetDownloader(input string) (ResolvedInput, error) {
+	resolved, err := ResolveInput(input)
+	if err != nil {
+		return resolved, err
+	}
+	if resolved.ChapterUUID == "" {
+		d.view = NewDownloader(ConfigInstance.UrlBase, resolved.PathWord, ConfigInstance)
+		return resolved, nil
+	}
+
+	err = d.QueueChapter(resolved.PathWord, resolved.ChapterUUID)
+	resolved.Queued = err == nil
+	return resolved, err
+}
+
+// QueueChapter 直接下载单个章节
+func (d *DownloaderManager) QueueChapter(pathWord string, chapterUUID string) error {
+	downloader := NewDownloader(ConfigInstance.UrlBase, pathWord, ConfigInstance)
+	chapter, err := downloader.GetChapterInfo(chapterUUID)
+	if err != nil {
+		return err
+	}
+	if err := downloader.GetBookInfo(); err != nil {
+		return err
+	}
+	d.enqueue([]*DownloaderSingle{downloader.newTask(chapter)})
+	return nil
 }
 
 func (d *DownloaderManager) GetBookInfo() (BookInfo, error) {
-	d.view.GetBookInfo()
+	if err := d.view.GetBookInfo(); err != nil {
+		return BookInfo{}, err
+	}
 	return *d.view.bookInfo, nil
 }
 
 func (d *DownloaderManager) GetComicChapter() ([]*ChapterInfo, error) {
-	d.view.GetComicChapter()
+	if err := d.view.GetComicChapter(); err != nil {
+		return nil, err
+	}
+	LibraryInstance.markLocal(d.view.bookInfo.UUID, d.view.pathWord, d.view.ChapterList)
 	return d.view.ChapterList, nil
 }
 
+// ChapterSelection 按表达式选择的结果. 表达式指定了其他分组时章节列表会被替换
+type ChapterSelection struct {
+	Chapters []*ChapterInfo `json:"chapters"`
+	Selected []int          `json:"selected"`
+}
+
+// SelectChapters 在当前漫画的章节列表中按表达式选择章节, 语法见 SelectChapters
+func (d *DownloaderManager) SelectChapters(expr string) (ChapterSelection, error) {
+	indexes, err := d.view.Select(expr)
+	if err != nil {
+		return ChapterSelection{}, err
+	}
+	return ChapterSelection{Chapters: d.view.ChapterList, Selected: indexes}, nil
+}
+
 func (d *DownloaderManager) DownloadList(chapters []int) {
-	downloaderSingleList := d.view.GetDownloadList(chapters)
-	for _, downloaderSingle := range downloaderSingleList {
-		d.downloadersChan <- downloaderSingle
+	d.enqueue(d.view.GetDownloadList(chapters))
+}
+
+// DownloadBundle 把选中的章节合并下载为单个文件, spec 为 volume, chunk:N 或 manual
+func (d *DownloaderManager) DownloadBundle(chapters []int, spec string) error {
+	tasks, err := d.view.newBundles(chapters, spec)
+	if err != nil {
+		return err
+	}
+	d.enqueue(tasks)
+	return nil
+}
+
+// BuildOmnibus 把当前漫画在本地已下载的章节合并为一本 EPUB, 返回生成的文件路径
+func (d *DownloaderManager) BuildOmnibus() (string, error) {
+	if d.view == nil {
+		return "", fmt.Errorf("没有打开漫画")
+	}
+	// bookInfo 在创建时就已分配, 没有 UUID 说明还没有获取漫画信息
+	if d.view.bookInfo.UUID == "" {
+		if err := d.view.GetBookInfo(); err != nil {
+			return "", err
+		}
 	}
+	return buildOmnibus(d.view)
+}
+
+func (d *DownloaderManager) enqueue(downloaderSingleList []*DownloaderSingle) {
 	muD.Lock()
 	d.downloaders = append(d.downloaders, downloaderSingleList...)
 	muD.Unlock()
+	for _, downloaderSingle := range downloaderSingleList {
+		d.emitter.Added(downloaderSingle)
+	}
+	d.scheduler.Enqueue(downloaderSingleList...)
 }
 
+// GetDownloaders 返回当前任务列表的快照
 func (d *DownloaderManager) GetDownloaders() []*DownloaderSingle {
-	return d.downloaders
+	muD.Lock()
+	defer muD.Unlock()
+	downloaders := make([]*DownloaderSingle, len(d.downloaders))
+	copy(downloaders, d.downloaders)
+	return downloaders
 }
 
 func (d *DownloaderManager) ClearDownloaders() {
-	index := 0
+	// 按任务状态清除已结束的任务, 失败的任务进度不会到 100
+	var removed, kept []*DownloaderSingle
 	muD.Lock()
-	for i, downloader := range d.downloaders {
-		if downloader.Progress < 100 {
-			break
+	for _, downloader := range d.downloaders {
+		if state := downloader.getState(); state == TaskStateDone || state == TaskStateFailed {
+			removed = append(removed, downloader)
+		} else {
+			kept = append(kept, downloader)
 		}
-		index = i + 1
 	}
-	d.downloaders = d.downloaders[index:]
+	d.downloaders = kept
 	muD.Unlock()
-	d.ProcessSend()
+	for _, downloader := range removed {
+		d.emitter.Removed(downloader)
+	}
+}
+
+func (d *DownloaderManager) GetSchedulerState() SchedulerState {
+	return d.scheduler.State()
+}
+
+// SetTaskNotBefore 设置单个排队任务的最早开始时间
+func (d *DownloaderManager) SetTaskNotBefore(id int64, notBefore time.Time) error {
+	return d.scheduler.SetTaskNotBefore(id, notBefore)
+}
+
+// SetComicNotBefore 设置整部漫画的最早开始时间
+func (d *DownloaderManager) SetComicNotBefore(pathWord string, notBefore time.Time) {
+	d.scheduler.SetComicNotBefore(pathWord, notBefore)
+}
+
+// ScanLibrary 扫描输出目录, 把带有漫画和章节信息但不在索引中的文件加入书库
+func (d *DownloaderManager) ScanLibrary() (ScanResult, error) {
+	return LibraryInstance.scan()
 }
 
-func (d *DownloaderManager) ProcessSend() {
-	runtime.EventsEmit(d.ctx, "progress", d.downloaders)
+// VerifyLibrary 校验本地库中的所有章节, requeue 为 true 时把损坏的章节重新加入下载队列,
+// 下载完成后按原格式覆盖原文件
+func (d *DownloaderManager) VerifyLibrary(requeue bool) VerifyResult {
+	result := LibraryInstance.verify()
+	if !requeue {
+		return result
+	}
+	// 同一部漫画只获取一次章节列表
+	downloaders := make(map[string]*Downloader)
+	for _, issue := range result.Broken {
+		// 单独重新下载会用一个章节覆盖整个合并文件
+		if issue.Bundle != "" {
+			fmt.Fprintln(logOutput, "Error requeueing chapter: bundled in", issue.FilePath)
+			result.Bundled = append(result.Bundled, issue)
+			continue
+		}
+		key := issue.PathWord + "/" + issue.Group
+		downloader, ok := downloaders[key]
+		if !ok {
+			downloader = NewDownloader(ConfigInstance.UrlBase, issue.PathWord, ConfigInstance)
+			if issue.Group != "" {
+				downloader.group = issue.Group
+			}
+			if err := downloader.GetComicInfo(); err != nil {
+				fmt.Fprintln(logOutput, "Error requeueing chapter:", err)
+				continue
+			}
+			downloaders[key] = downloader
+		}
+		task := downloader.redownloadTask(issue.ChapterUUID, issue.Format, issue.FilePath)
+		if task == nil {
+			fmt.Fprintln(logOutput, "Error requeueing chapter: not found upstream:", issue.FilePath)
+			continue
+		}
+		d.enqueue([]*DownloaderSingle{task})
+		result.Requeued++
+	}
+	return result
+}
+
+// UpstreamChanges 源站更新检查的结果
+type UpstreamChanges struct {
+	Changed []LibraryChapter `json:"changed"`
+	// 已重新加入下载队列的章节数
+	Requeued int `json:"requeued"`
+	// 在合并文件中, 不能单独重新下载的章节
+	Bundled []LibraryChapter `json:"bundled"`
+}
+
+// CheckUpstreamChanges 检查漫画已下载的章节是否被源站替换过, refetch 为 true 时重新下载.
+// 合并文件中的章节不会单独重新下载, 在结果中列出
+func (d *DownloaderManager) CheckUpstreamChanges(pathWord string, refetch bool) (UpstreamChanges, error) {
+	result := UpstreamChanges{Changed: []LibraryChapter{}, Bundled: []LibraryChapter{}}
+	downloader := NewDownloader(ConfigInstance.UrlBase, pathWord, ConfigInstance)
+	if err := downloader.GetComicInfo(); err != nil {
+		return result, err
+	}
+	result.Changed = LibraryInstance.detectChanges(downloader.bookInfo.UUID, pathWord, downloader.ChapterList, downloader.chapterFingerprints)
+	if !refetch {
+		return result, nil
+	}
+	for _, local := range result.Changed {
+		if local.Bundle != "" {
+			fmt.Fprintln(logOutput, "Error refetching chapter: bundled in", local.FilePath)
+			result.Bundled = append(result.Bundled, local)
+			continue
+		}
+		if task := downloader.redownloadTask(local.UUID, local.Format, local.FilePath); task != nil {
+			d.enqueue([]*DownloaderSingle{task})
+			result.Requeued++
+		}
+	}
+	return result, nil
 }
@@ -1,25 +1,102 @@
 package main
 
 import (
-	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tidwall/gjson"
 )
 
+var taskID atomic.Int64
+
 type DownloaderSingle struct {
+	ID       int64        `json:"id"`
 	urlBase  string       `json:"-"`
 	PathWord string       `json:"pathWord"`
+	Group    string       `json:"group"`
 	Chapter  *ChapterInfo `json:"chapter"`
 	BookInfo *BookInfo    `json:"bookInfo"`
 	Progress float64      `json:"progress"`
-	config   *Config      `json:"-"`
+	State    string       `json:"state"`
+	// 最早开始时间, 零值表示不限制
+	NotBefore time.Time `json:"notBefore"`
+	config    *Config   `json:"-"`
+	// 指定输出文件路径, 用于原地重新下载, 为空时按命名风格生成
+	target string
+	// 所属的合并任务, 不为空时只下载图片, 由合并任务统一打包
+	bundle *Bundle
+
+	// 每页图片的尺寸等信息, 下标与页码对应
+	pages []PageInfo
+	// 每页远端图片的指纹, 记入书库用于发现源站替换的页面
+	fingerprints []string
+	mu           sync.Mutex
+}
+
+func nextTaskID() int64 {
+	return taskID.Add(1)
+}
+
+func (d *DownloaderSingle) GetProgress() float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.Progress
+}
+
+func (d *DownloaderSingle) setProgress(progress float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Progress = progress
+}
+
+func (d *DownloaderSingle) getState() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.State
+}
+
+func (d *DownloaderSingle) setState(state string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.State = state
+}
+
+func (d *DownloaderSingle) getNotBefore() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.NotBefore
+}
+
+func (d *DownloaderSingle) setNotBefore(notBefore time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.NotBefore = notBefore
+}
+
+// MarshalJSON 在锁内序列化, 避免与下载协程竞争
+func (d *DownloaderSingle) MarshalJSON() ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return json.Marshal(struct {
+		ID        int64        `json:"id"`
+		PathWord  string       `json:"pathWord"`
+		Chapter   *ChapterInfo `json:"chapter"`
+		BookInfo  *BookInfo    `json:"bookInfo"`
+		Group     string       `json:"group"`
+		Progress  float64      `json:"progress"`
+		State     string       `json:"state"`
+		NotBefore time.Time    `json:"notBefore"`
+	}{d.ID, d.PathWord, d.Chapter, d.BookInfo, d.Group, d.Progress, d.State, d.NotBefore})
 }
 
 func (d *DownloaderSingle) Download(processSend func()) error {
@@ -31,7 +108,14 @@ func (d *DownloaderSingle) Download(processSend func()) error {
 	}
 
 	var folderPath string
-	if d.config.NamingStyle == "03d-index-title" {
+	if d.bundle != nil {
+		folderPath = d.bundle.chapterDir(d)
+	} else if d.target != "" && archiveFormat(d.target) == "" {
+		// 图片目录
+		folderPath = d.target
+	} else if d.target != "" {
+		folderPath = trimPackageExt(d.target)
+	} else if d.config.NamingStyle == "03d-index-title" {
 		folderPath = filepath.Join(d.config.OutputPath, d.BookInfo.Series, fmt.Sprintf("%03d-%s", index, sanitizeFilename(chapter.Name)))
 	} else if d.config.NamingStyle == "02d-index-title" {
 		folderPath = filepath.Join(d.config.OutputPath, d.BookInfo.Series, fmt.Sprintf("%02d-%s", index, sanitizeFilename(chapter.Name)))
@@ -41,13 +125,15 @@ func (d *DownloaderSingle) Download(processSend func()) error {
 		folderPath = filepath.Join(d.config.OutputPath, d.BookInfo.Series, sanitizeFilename(chapter.Name))
 	}
 	os.MkdirAll(folderPath, os.ModePerm)
+	outputPath := folderPath
 
 	var wg sync.WaitGroup
 	maxConcurrency := 16
 	sem := make(chan struct{}, maxConcurrency)
 
 	total := len(imageUrls)
-	downloadedImages := 0
+	var downloadedImages atomic.Int64
+	pages := make([]PageInfo, total)
 
 	for i, url := range imageUrls {
 		wg.Add(1)
@@ -55,13 +141,14 @@ func (d *DownloaderSingle) Download(processSend func()) error {
 		go func(i int, url string) {
 			defer wg.Done()
 			filePath := filepath.Join(folderPath, fmt.Sprintf("%03d.%s", i+1, strings.Split(url, ".")[len(strings.Split(url, "."))-1]))
-			err := d.DownloadImage(url, filePath)
+			page, err := d.DownloadImage(url, filePath)
 			if err != nil {
-				fmt.Println("Error downloading image:", err)
+				fmt.Fprintln(logOutput, "Error downloading image:", err)
+			} else {
+				pages[i] = page
 			}
-			downloadedImages++
-			process := float64(downloadedImages) / float64(total) * 100
-			d.Progress = process
+			process := float64(downloadedImages.Add(1)) / float64(total) * 100
+			d.setProgress(process)
 			processSend()
 			<-sem
 		}(i, url)
@@ -69,90 +156,200 @@ func (d *DownloaderSingle) Download(processSend func()) error {
 
 	wg.Wait()
 
-	if d.config.PackageType == "cbz" {
-		comicInfo := ComicInfo{
-			Series:    d.BookInfo.Series,
-			Writer:    d.BookInfo.Author,
-			Summary:   d.BookInfo.Description,
-			Genre:     d.BookInfo.Genre,
-			Title:     chapter.Name,
-			Number:    fmt.Sprintf("%d", index+1),
-			PageCount: fmt.Sprintf("%d", len(imageUrls)),
+	// 缺页的章节不打包, 否则会作为完整章节记入书库, 订阅也不会再下载
+	missing := 0
+	for _, page := range pages {
+		if page.Name == "" {
+			missing++
 		}
-		comicInfo.Build(folderPath)
-		zipPath := folderPath + ".cbz"
-		err = CreateZipFromDirectory(folderPath, zipPath)
+	}
+	if missing > 0 {
+		return fmt.Errorf("%s: %d/%d 页下载失败", chapter.Name, missing, total)
+	}
+	d.mu.Lock()
+	d.pages = pages
+	d.fingerprints = pageFingerprints(imageUrls)
+	d.mu.Unlock()
+	if d.bundle != nil {
+		return nil
+	}
+
+	// 先打包到临时文件, 校验通过后再保留旧版本并替换
+	if ext := packageExt(d.config.PackageType); ext != "" {
+		outputPath = folderPath + ext
+		err := buildVersioned(outputPath, d.config.versionRetention(), func(tmpPath string) error {
+			if err := d.buildPackage(tmpPath, folderPath, pages); err != nil {
+				return err
+			}
+			if err := validatePackage(tmpPath, d.config.PackageType); err != nil {
+				return fmt.Errorf("%s: %v", outputPath, err)
+			}
+			return nil
+		})
 		if err != nil {
 			return err
 		}
 		os.RemoveAll(folderPath)
-	} else if d.config.PackageType == "zip" {
-		zipPath := folderPath + ".zip"
-		err = CreateZipFromDirectory(folderPath, zipPath)
-		if err != nil {
+	}
+	fmt.Fprintln(logOutput, folderPath)
+
+	if err := LibraryInstance.record(d, outputPath, pages); err != nil {
+		fmt.Fprintln(logOutput, "Error updating library:", err)
+	}
+
+	return nil
+}
+
+// buildPackage 把章节的图片目录按打包格式写入 path
+func (d *DownloaderSingle) buildPackage(path string, folderPath string, pages []PageInfo) error {
+	chapter := d.Chapter
+	if d.config.PackageType == "cbz" {
+		comicInfo := NewComicInfo(d, pages)
+		if err := comicInfo.Build(folderPath); err != nil {
 			return err
 		}
-		os.RemoveAll(folderPath)
-	} else if d.config.PackageType == "epub" {
-		zipPath := folderPath + ".epub"
-		index = index + 1
-		MetaData := MetaData{
-			Title:       d.Chapter.Name,
-			Creator:     &d.BookInfo.Author,
-			Description: &d.BookInfo.Description,
-			Subject:     strings.Split(d.BookInfo.Genre, ", "),
-			Index:       &index,
-			Series:      &d.BookInfo.Series,
+		return CreateZipFromDirectory(folderPath, path, d.config.Compression)
+	} else if d.config.PackageType == "cbt" {
+		comicInfo := NewComicInfo(d, pages)
+		if err := comicInfo.Build(folderPath); err != nil {
+			return err
 		}
-
+		return CreateTarFromDirectory(folderPath, path)
+	} else if d.config.PackageType == "zip" {
+		return CreateZipFromDirectory(folderPath, path, d.config.Compression)
+	} else if d.config.PackageType == "epub" || d.config.PackageType == "kepub" {
+		index := chapter.Index + 1
+		// NewMetaData 会转义传入的字段, 不能直接传 BookInfo 中字段的指针
+		author, description, series := d.BookInfo.Author, d.BookInfo.Description, d.BookInfo.Series
+		identifier := "urn:uuid:" + stableUUID(d.BookInfo.UUID, chapter.UUID)
 		epubBuilder := EpubBuilder{
-			metadata: MetaData,
+			metadata: NewMetaData(chapter.Name, &author, nil, &description, &series, strings.Split(d.BookInfo.Genre, ", "), nil, &index, &identifier),
+			rtl:      d.BookInfo.rightToLeft(),
+			kobo:     d.config.PackageType == "kepub",
+			identity: d.identity(),
 		}
-		epubBuilder.BuildComic(zipPath, folderPath)
-		os.RemoveAll(folderPath)
+		return epubBuilder.BuildComicChapters(path, []ComicChapter{{Title: chapter.Name, ImgPath: folderPath}})
+	} else if d.config.PackageType == "mobi" || d.config.PackageType == "azw3" {
+		mobiBuilder := d.mobiBuilder(fmt.Sprintf("%s %s", d.BookInfo.Series, chapter.Name))
+		mobiBuilder.Source = fmt.Sprintf("https://%s/comic/%s/chapter/%s", d.urlBase, d.PathWord, chapter.UUID)
+		mobiBuilder.Identity = d.identity()
+		if err := mobiBuilder.AddChapter(chapter.Name, folderPath); err != nil {
+			return err
+		}
+		return mobiBuilder.Build(path)
+	} else if d.config.PackageType == "pdf" {
+		pdfBuilder := PdfBuilder{
+			Title:    fmt.Sprintf("%s - %s", d.BookInfo.Series, chapter.Name),
+			Author:   d.BookInfo.Author,
+			Subject:  d.BookInfo.Description,
+			Keywords: d.BookInfo.Genre,
+			Identity: d.identity(),
+		}
+		if err := pdfBuilder.AddChapter(chapter.Name, folderPath); err != nil {
+			return err
+		}
+		return pdfBuilder.Build(path)
 	}
-	println(folderPath)
+	return fmt.Errorf("unknown package type: %s", d.config.PackageType)
+}
 
-	return nil
+// identity 返回写入文件元数据的漫画和章节标识
+func (d *DownloaderSingle) identity() string {
+	return fileIdentity(d.PathWord, d.BookInfo.UUID, []string{d.Chapter.UUID})
+}
+
+// mobiBuilder 用漫画信息填写 MOBI/AZW3 的元数据, 日漫从右向左翻页
+func (d *DownloaderSingle) mobiBuilder(title string) *MobiBuilder {
+	var subject []string
+	if d.BookInfo.Genre != "" {
+		subject = strings.Split(d.BookInfo.Genre, ", ")
+	}
+	return &MobiBuilder{
+		Title:       title,
+		Author:      d.BookInfo.Author,
+		Description: d.BookInfo.Description,
+		Subject:     subject,
+		Identifier:  d.BookInfo.UUID,
+		Rtl:         d.BookInfo.rightToLeft(),
+	}
 }
 
-func (d *DownloaderSingle) DownloadImage(url, filePath string) error {
+func (d *DownloaderSingle) DownloadImage(url, filePath string) (PageInfo, error) {
 	maxRetries := 50
-	url = strings.Replace(url, ".c800x.", ".c1500x.", 1)
+	quality, _ := d.config.imageOptions(d.PathWord)
+	variants := imageVariants(url, quality)
 
 	for i := 0; i < maxRetries; i++ {
-		resp, err := client.Get(url)
-		if err != nil {
-			fmt.Println("Error downloading image:", err)
-			time.Sleep(3 * time.Second)
+		variant := variants[0]
+		page, err := fetchImage(variant.URL, filePath, d.config.imageCheckMode())
+		if errors.Is(err, errImageNotFound) && len(variants) > 1 {
+			// 该分辨率不存在, 降级到下一档
+			variants = variants[1:]
 			continue
 		}
-		defer resp.Body.Close()
-
-		imgData, err := io.ReadAll(resp.Body)
 		if err != nil {
+			fmt.Fprintln(logOutput, "Error downloading image:", err)
 			time.Sleep(3 * time.Second)
 			continue
 		}
 
-		if !isImage(imgData) {
-			fmt.Println(string(imgData))
-			time.Sleep(3 * time.Second)
-			continue
+		// AVIF 没有解码器, 拿不到尺寸, 需要解析图片的格式无法打包, 重试也没有意义
+		if page.Format == "" && decodesImages(d.config.PackageType) {
+			os.Remove(filePath)
+			return page, fmt.Errorf("%s: 无法解析的图片格式, 不能打包为 %s", url, d.config.PackageType)
 		}
+		page.Variant = variant.Quality
+		return page, nil
+	}
 
-		err = os.WriteFile(filePath, imgData, 0644)
-		if err != nil {
-			fmt.Println("Error writing image file:", err)
-			time.Sleep(3 * time.Second)
-			continue
-		}
+	return PageInfo{Name: filepath.Base(filePath)}, fmt.Errorf("failed to download image: %s", url)
 
-		return nil
+}
+
+// fetchImage 将图片流式写入临时文件, 校验通过后重命名到 filePath
+func fetchImage(url, filePath string, checkMode string) (PageInfo, error) {
+	page := PageInfo{Name: filepath.Base(filePath)}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return page, err
 	}
+	defer resp.Body.Close()
 
-	return fmt.Errorf("failed to download image: %s", url)
+	if resp.StatusCode == http.StatusNotFound {
+		return page, fmt.Errorf("%w: %s", errImageNotFound, url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return page, fmt.Errorf("unexpected status %s: %s", resp.Status, url)
+	}
 
+	body := bufio.NewReaderSize(resp.Body, 512)
+	head, err := body.Peek(512)
+	if err != nil && err != io.EOF {
+		return page, err
+	}
+	if !isImage(head) {
+		return page, fmt.Errorf("response is not an image: %s", head)
+	}
+
+	err = atomicWriteFile(filePath, func(f *os.File) error {
+		n, err := io.Copy(f, body)
+		if err != nil {
+			return err
+		}
+		if resp.ContentLength >= 0 && n != resp.ContentLength {
+			return fmt.Errorf("image truncated: got %d of %d bytes", n, resp.ContentLength)
+		}
+
+		info, err := checkImage(f, n, checkMode)
+		if err != nil {
+			return err
+		}
+		info.Name = page.Name
+		page = info
+		return nil
+	})
+	return page, err
 }
 
 var mu sync.Mutex
@@ -195,7 +392,15 @@ func (d *DownloaderSingle) GetImageUrlListUseToken(chapterUUID string, token str
 		client.Transport.(*HeaderRoundTripper).Headers["Authorization"] = fmt.Sprintf("Token %s", token)
 	}
 
-	resp, err := client.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, preferWebp := d.config.imageOptions(d.PathWord); preferWebp {
+		req.Header.Set("webp", "1")
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -226,46 +431,46 @@ func (d *DownloaderSingle) GetImageUrlListUseToken(chapterUUID string, token str
 	return imageUrls, nil
 }
 
-func CreateZipFromDirectory(sourceDir, zipPath string) error {
-	zipFile, err := os.Create(zipPath)
-	if err != nil {
-		return err
-	}
-	defer zipFile.Close()
+// CreateZipFromDirectory 把目录打包为 zip, compression 决定图片的压缩方式
+func CreateZipFromDirectory(sourceDir, zipPath string, compression string) error {
+	imageMethod, level := parseCompression(compression)
+	return atomicWriteFile(zipPath, func(zipFile *os.File) error {
+		zipWriter := newZipWriter(zipFile, level)
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+		err := filepath.Walk(sourceDir, func(file string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
 
-	err = filepath.Walk(sourceDir, func(file string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+			// 跳过目录本身和未完成的临时文件
+			if fi.IsDir() || isTempFile(file) {
+				return nil
+			}
 
-		// 跳过目录本身
-		if fi.IsDir() {
-			return nil
-		}
+			// 创建一个文件在压缩包中
+			relPath, err := filepath.Rel(sourceDir, file)
+			if err != nil {
+				return err
+			}
 
-		// 创建一个文件在压缩包中
-		relPath, err := filepath.Rel(sourceDir, file)
-		if err != nil {
-			return err
-		}
+			writer, err := createZipEntry(zipWriter, filepath.ToSlash(relPath), imageMethod)
+			if err != nil {
+				return err
+			}
 
-		writer, err := zipWriter.Create(relPath)
-		if err != nil {
-			return err
-		}
+			fileReader, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer fileReader.Close()
 
-		fileReader, err := os.Open(file)
+			_, err = io.Copy(writer, fileReader)
+			return err
+		})
 		if err != nil {
 			return err
 		}
-		defer fileReader.Close()
 
-		_, err = io.Copy(writer, fileReader)
-		return err
+		return zipWriter.Close()
 	})
-
-	return err
 }
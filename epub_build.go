@@ -2,8 +2,9 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
 	"fmt"
-	"io"
+	"image"
 	"os"
 	"path/filepath"
 	"strings"
@@ -49,6 +50,11 @@ func NewMetaData(
 	if language != nil {
 		*language = escapeEpubText(*language)
 	}
+	// 复制一份, 不修改调用方的切片
+	escapedSubject := make([]string, len(subject))
+	for i, item := range subject {
+		escapedSubject[i] = escapeEpubText(item)
+	}
 	if identifier != nil {
 		*identifier = escapeEpubText(*identifier)
 	}
@@ -58,21 +64,45 @@ func NewMetaData(
 		Publisher:   publisher,
 		Description: description,
 		Series:      series,
-		Subject:     subject,
+		Subject:     escapedSubject,
 		Language:    language,
 		Index:       index,
 		Identifier:  identifier,
 	}
 }
 
+// epubIdentityMeta 保存 fileIdentity 标识的 meta 名称
+const epubIdentityMeta = "copymanga:identity"
+
 type EpubBuilder struct {
 	metadata    MetaData
 	text        []string
 	chapterList []string
-	imgDataList [][]byte
-	extList     []string
-	imgPathList []string
-	addCatalog  bool
+	// 每个章节第一页的编号, 为空时每个章节只有一页
+	chapterPages []int
+	imgDataList  [][]byte
+	extList      []string
+	addCatalog   bool
+	// 漫画每页的图片, 与 text 一一对应
+	pageList []comicPage
+	// 封面图片, 取自 imgDataList 的第一项
+	cover comicPage
+	// 固定版式, 用于漫画
+	fixedLayout bool
+	// 从右向左翻页, 用于日漫
+	rtl bool
+	// 生成 Kobo 阅读器使用的 KEPUB
+	kobo bool
+	// fileIdentity 生成的标识, 扫描书库时用于匹配
+	identity string
+}
+
+// comicPage 漫画中的一张图片, href 相对于 OEBPS/Images
+type comicPage struct {
+	href      string
+	mediaType string
+	width     int
+	height    int
 }
 
 func NewEpubBuilder(
@@ -116,21 +146,33 @@ func (eb *EpubBuilder) BuildEpub() map[string][]byte {
 	return epub
 }
 
+// ComicChapter 漫画 EPUB 中的一个章节, ImgPath 为章节的图片目录
+type ComicChapter struct {
+	Title   string
+	ImgPath string
+}
+
 func (eb *EpubBuilder) BuildComic(path string, imgPath string) error {
+	return eb.BuildComicChapters(path, []ComicChapter{{ImgPath: imgPath}})
+}
+
+// BuildComicChapters 把多个章节的图片打包为一个 EPUB, 有标题的章节会加入目录
+func (eb *EpubBuilder) BuildComicChapters(path string, chapters []ComicChapter) error {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		return fmt.Errorf("创建目录失败: %v", err)
 	}
 
-	zipFile, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer zipFile.Close()
-
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	return atomicWriteFile(path, func(zipFile *os.File) error {
+		zipWriter := zip.NewWriter(zipFile)
+		if err := eb.writeComic(zipWriter, chapters); err != nil {
+			return err
+		}
+		return zipWriter.Close()
+	})
+}
 
+func (eb *EpubBuilder) writeComic(zipWriter *zip.Writer, chapters []ComicChapter) error {
 	mimetype := &zip.FileHeader{
 		Name:   "mimetype",
 		Method: zip.Store,
@@ -143,15 +185,84 @@ func (eb *EpubBuilder) BuildComic(path string, imgPath string) error {
 	}
 	mimetypeFile.Write([]byte("application/epub+zip"))
 
+	eb.fixedLayout = true
 	eb.text = make([]string, 0, 300)
-	eb.imgPathList = make([]string, 0, 300)
-	err = filepath.Walk(imgPath, func(file string, info os.FileInfo, err error) error {
+	eb.pageList = make([]comicPage, 0, 300)
+	eb.chapterList = nil
+	eb.chapterPages = nil
+	for i, chapter := range chapters {
+		// 多个章节时按章节分目录, 避免图片重名
+		prefix := ""
+		if len(chapters) > 1 {
+			prefix = fmt.Sprintf("%03d/", i+1)
+		}
+		firstPage := len(eb.text) + 1
+		if err := eb.writeComicImages(zipWriter, chapter.ImgPath, prefix); err != nil {
+			return err
+		}
+		// 没有图片的章节不加入目录
+		if chapter.Title != "" && len(eb.text) >= firstPage {
+			eb.chapterList = append(eb.chapterList, escapeEpubText(chapter.Title))
+			eb.chapterPages = append(eb.chapterPages, firstPage)
+		}
+	}
+	if len(eb.text) == 0 {
+		return fmt.Errorf("没有图片")
+	}
+	// 目录不能为空, 没有章节标题时以书名指向第一页
+	if len(eb.chapterList) == 0 {
+		eb.chapterList = []string{eb.metadata.Title}
+		eb.chapterPages = []int{1}
+	}
+	if len(eb.extList) > 0 {
+		cover, err := newComicPage("000"+eb.extList[0], eb.imgDataList[0])
+		if err != nil {
+			return fmt.Errorf("cover: %v", err)
+		}
+		eb.cover = cover
+	}
+
+	epub := make(map[string][]byte)
+	epub["META-INF/container.xml"] = []byte(eb.buildContainer())
+	epub["OEBPS/content.opf"] = []byte(eb.buildOpf())
+	epub["OEBPS/toc.ncx"] = []byte(eb.buildNcx())
+	epub["OEBPS/Text/nav.xhtml"] = []byte(eb.buildNavXhtml())
+	// 封面放在 imgDataList 的第一项
+	if len(eb.extList) > 0 {
+		epub["OEBPS/Text/cover.xhtml"] = []byte(eb.buildCoverXhtml())
+		epub[fmt.Sprintf("OEBPS/Images/000%s", eb.extList[0])] = eb.imgDataList[0]
+	}
+	for i := 0; i < len(eb.text); i++ {
+		epub[fmt.Sprintf("OEBPS/Text/%s.xhtml", eb.numFill(i+1))] = []byte(eb.buildComicXhtml(i))
+	}
+	// Kobo 的 KEPUB 阅读器参考 iBooks 的设置判断固定版式
+	if eb.kobo {
+		epub["META-INF/com.apple.ibooks.display-options.xml"] = []byte(eb.buildDisplayOptions())
+	}
+
+	for fileName, fileData := range epub {
+		if fileName == "mimetype" {
+			continue
+		}
+		file, err := zipWriter.Create(fileName)
+		if err != nil {
+			return err
+		}
+		file.Write(fileData)
+	}
+
+	return nil
+}
+
+// writeComicImages 把图片目录写入 OEBPS/Images/prefix 下, 每张图片对应一页
+func (eb *EpubBuilder) writeComicImages(zipWriter *zip.Writer, imgPath string, prefix string) error {
+	return filepath.Walk(imgPath, func(file string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// 跳过目录本身
-		if info.IsDir() {
+		// 跳过目录本身, 未完成的临时文件和图片以外的文件
+		if info.IsDir() || isTempFile(file) || !isImageName(file) {
 			return nil
 		}
 
@@ -161,53 +272,100 @@ func (eb *EpubBuilder) BuildComic(path string, imgPath string) error {
 			return err
 		}
 
-		relPath = filepath.ToSlash(relPath)
+		relPath = prefix + filepath.ToSlash(relPath)
 
 		imgPath := filepath.ToSlash(filepath.Join("OEBPS/Images", relPath))
 
-		writer, err := zipWriter.Create(imgPath)
+		data, err := os.ReadFile(file)
 		if err != nil {
 			return err
 		}
-
-		fileReader, err := os.Open(file)
+		page, err := newComicPage(relPath, data)
 		if err != nil {
-			return err
+			return fmt.Errorf("%s: %v", relPath, err)
 		}
-		defer fileReader.Close()
-
-		_, err = io.Copy(writer, fileReader)
 
+		writer, err := zipWriter.Create(imgPath)
 		if err != nil {
 			return err
 		}
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
 
 		eb.text = append(eb.text, eb.BuildComicTag(fmt.Sprintf("../Images/%s", relPath)))
-
-		eb.imgPathList = append(eb.imgPathList, relPath)
-		return err
+		eb.pageList = append(eb.pageList, page)
+		return nil
 	})
+}
 
-	epub := make(map[string][]byte)
-	epub["META-INF/container.xml"] = []byte(eb.buildContainer())
-	epub["OEBPS/content.opf"] = []byte(eb.buildOpf())
-	epub["OEBPS/Text/nav.xhtml"] = []byte(eb.buildNavXhtml())
-	for i := 0; i < len(eb.text); i++ {
-		epub[fmt.Sprintf("OEBPS/Text/%s.xhtml", eb.numFill(i+1))] = []byte(eb.buildXhtml("", eb.text[i]))
-	}
+// newComicPage 读取图片的尺寸和实际格式
+func newComicPage(href string, data []byte) (comicPage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return comicPage{}, err
+	}
+	return comicPage{
+		href:      href,
+		mediaType: "image/" + format,
+		width:     config.Width,
+		height:    config.Height,
+	}, nil
+}
 
-	for fileName, fileData := range epub {
-		if fileName == "mimetype" {
-			continue
-		}
-		file, err := zipWriter.Create(fileName)
-		if err != nil {
-			return err
-		}
-		file.Write(fileData)
+// imageMediaType 按图片内容判断媒体类型, 无法识别时按扩展名判断
+func imageMediaType(data []byte, ext string) string {
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		return "image/" + format
+	}
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "jpg", "jpeg":
+		return "image/jpeg"
+	case "png":
+		return "image/png"
+	case "gif":
+		return "image/gif"
+	case "webp":
+		return "image/webp"
+	}
+	return "application/octet-stream"
+}
+
+// buildComicXhtml 生成第 i 页的固定版式页面, 视口与图片尺寸一致.
+// KEPUB 的页面按 Kobo 的要求包在 book-columns 和 koboSpan 中
+func (eb *EpubBuilder) buildComicXhtml(i int) string {
+	page := eb.pageList[i]
+	style := fmt.Sprintf("html, body { margin: 0; padding: 0; } img { display: block; width: %dpx; height: %dpx; }", page.width, page.height)
+	body := eb.text[i]
+	if eb.kobo {
+		style += " div#book-inner { margin-top: 0; margin-bottom: 0; }"
+		body = fmt.Sprintf(`
+    <div id="book-columns"><div id="book-inner"><span class="koboSpan" id="kobo.%d.1">%s</span></div></div>`,
+			i+1, strings.TrimSpace(body))
 	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html>
+
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+  <head>
+    <title>%s</title>
+    <meta name="viewport" content="width=%d, height=%d"/>
+    <style type="text/css">%s</style>
+  </head>
+  <body>%s
+  </body>
+</html>`, eb.numFill(i+1), page.width, page.height, style, body)
+}
 
-	return err
+// buildDisplayOptions 声明固定版式, Kobo 阅读器据此关闭重排
+func (eb *EpubBuilder) buildDisplayOptions() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<display_options>
+  <platform name="*">
+    <option name="fixed-layout">true</option>
+    <option name="open-to-spread">false</option>
+  </platform>
+</display_options>`
 }
 
 func (eb *EpubBuilder) BuildComicTag(imgPath string) string {
@@ -223,34 +381,29 @@ func (eb *EpubBuilder) SaveFile(path string) error {
 
 	fileMap := eb.BuildEpub()
 
-	zipFile, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer zipFile.Close()
-
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	return atomicWriteFile(path, func(zipFile *os.File) error {
+		zipWriter := zip.NewWriter(zipFile)
 
-	// Write mimetype first
-	mimetypeFile, err := zipWriter.Create("mimetype")
-	if err != nil {
-		return err
-	}
-	mimetypeFile.Write(fileMap["mimetype"])
-
-	for fileName, fileData := range fileMap {
-		if fileName == "mimetype" {
-			continue
-		}
-		file, err := zipWriter.Create(fileName)
+		// Write mimetype first
+		mimetypeFile, err := zipWriter.Create("mimetype")
 		if err != nil {
 			return err
 		}
-		file.Write(fileData)
-	}
+		mimetypeFile.Write(fileMap["mimetype"])
+
+		for fileName, fileData := range fileMap {
+			if fileName == "mimetype" {
+				continue
+			}
+			file, err := zipWriter.Create(fileName)
+			if err != nil {
+				return err
+			}
+			file.Write(fileData)
+		}
 
-	return nil
+		return zipWriter.Close()
+	})
 }
 
 func (eb *EpubBuilder) buildNcx() string {
@@ -259,6 +412,7 @@ func (eb *EpubBuilder) buildNcx() string {
  "http://www.daisy.org/z3986/2005/ncx-2005-1.dtd">
 <ncx version="2005-1" xmlns="http://www.daisy.org/z3986/2005/ncx/">
   <head>
+    <meta name="dtb:uid" content="%s" />
     <meta name="dtb:depth" content="1" />
     <meta name="dtb:totalPageCount" content="0" />
     <meta name="dtb:maxPageNumber" content="0" />
@@ -269,7 +423,7 @@ func (eb *EpubBuilder) buildNcx() string {
   <navMap>
     %s
   </navMap>
-</ncx>`, eb.metadata.Title, eb.getNavXml())
+</ncx>`, eb.identifier(), eb.metadata.Title, eb.getNavXml())
 }
 
 func (eb *EpubBuilder) getNavXml() string {
@@ -280,7 +434,7 @@ func (eb *EpubBuilder) getNavXml() string {
         <text>%s</text>
       </navLabel>
       <content src="%s" />
-    </navPoint>`, i+1, i+1, eb.chapterList[i], fmt.Sprintf("Text/%s.xhtml", eb.numFill(i+1))))
+    </navPoint>`, i+1, i+1, eb.chapterList[i], fmt.Sprintf("Text/%s.xhtml", eb.chapterPage(i))))
 	}
 	return strings.Join(navMap, "\n    ")
 }
@@ -289,6 +443,10 @@ func (eb *EpubBuilder) buildOpf() string {
 	metadata := eb.getMetadataXml()
 	manifest := eb.getManifestXml()
 	spine := eb.getSpineXml()
+	direction := ""
+	if eb.rtl {
+		direction = ` page-progression-direction="rtl"`
+	}
 	// guide := eb.getGuideXml()
 	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
 <package version="3.0" unique-identifier="BookId" xmlns="http://www.idpf.org/2007/opf">
@@ -298,10 +456,10 @@ func (eb *EpubBuilder) buildOpf() string {
   <manifest>
     %s
   </manifest>
-  <spine>
+  <spine toc="ncx"%s>
     %s
   </spine>
-</package>`, metadata, manifest, spine)
+</package>`, metadata, manifest, direction, spine)
 }
 
 func (eb *EpubBuilder) getGuideXml() string {
@@ -327,7 +485,7 @@ func (eb *EpubBuilder) getManifestXml() string {
 	if len(eb.extList) > 0 {
 		manifest = append(manifest, `<item id="cover.xhtml" href="Text/cover.xhtml" media-type="application/xhtml+xml"/>`)
 	}
-	// manifest = append(manifest, `<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>`)
+	manifest = append(manifest, `<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>`)
 
 	for i := 0; i < len(eb.text); i++ {
 		manifest = append(manifest, fmt.Sprintf(`<item id="x%s.xhtml" href="Text/%s.xhtml" media-type="application/xhtml+xml"/>`, eb.numFill(i+1), eb.numFill(i+1)))
@@ -335,10 +493,22 @@ func (eb *EpubBuilder) getManifestXml() string {
 
 	for i := 0; i < len(eb.imgDataList); i++ {
 		ext := strings.Split(eb.extList[i], ".")[len(strings.Split(eb.extList[i], "."))-1]
-		manifest = append(manifest, fmt.Sprintf(`<item id="x%s.%s" href="Images/%s.%s" media-type="image/jpeg"/>`, eb.numFill(i), ext, eb.numFill(i), ext))
-	}
-	for i, imgPath := range eb.imgPathList {
-		manifest = append(manifest, fmt.Sprintf(`<item id="x%s" href="Images/%s" media-type="image/jpeg"/>`, fmt.Sprintf("%03d", i), imgPath))
+		// 第一张图片为封面
+		properties := ""
+		if i == 0 {
+			properties = ` properties="cover-image"`
+		}
+		manifest = append(manifest, fmt.Sprintf(`<item id="x%s.%s" href="Images/%s.%s" media-type="%s"%s/>`,
+			eb.numFill(i), ext, eb.numFill(i), ext, imageMediaType(eb.imgDataList[i], ext), properties))
+	}
+	for i, page := range eb.pageList {
+		// 没有单独的封面时以第一页作为封面
+		properties := ""
+		if i == 0 && len(eb.imgDataList) == 0 {
+			properties = ` properties="cover-image"`
+		}
+		manifest = append(manifest, fmt.Sprintf(`<item id="img%s" href="Images/%s" media-type="%s"%s/>`,
+			eb.numFill(i+1), page.href, page.mediaType, properties))
 	}
 	manifest = append(manifest, `<item id="nav.xhtml" href="Text/nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`)
 	if eb.addCatalog {
@@ -350,13 +520,13 @@ func (eb *EpubBuilder) getManifestXml() string {
 func (eb *EpubBuilder) getMetadataXml() string {
 	var metadata []string
 	metadata = append(metadata, fmt.Sprintf(`<dc:title>%s</dc:title>`, eb.metadata.Title))
-	if eb.metadata.Creator != nil {
+	if eb.metadata.Creator != nil && *eb.metadata.Creator != "" {
 		metadata = append(metadata, fmt.Sprintf(`<dc:creator>%s</dc:creator>`, *eb.metadata.Creator))
 	}
 	if eb.metadata.Publisher != nil {
 		metadata = append(metadata, fmt.Sprintf(`<dc:publisher>%s</dc:publisher>`, *eb.metadata.Publisher))
 	}
-	if eb.metadata.Description != nil {
+	if eb.metadata.Description != nil && *eb.metadata.Description != "" {
 		metadata = append(metadata, fmt.Sprintf(`<dc:description>%s</dc:description>`, *eb.metadata.Description))
 	}
 	if eb.metadata.Language != nil {
@@ -364,13 +534,11 @@ func (eb *EpubBuilder) getMetadataXml() string {
 	} else {
 		metadata = append(metadata, `<dc:language>zh</dc:language>`)
 	}
-	if eb.metadata.Identifier != nil {
-		metadata = append(metadata, fmt.Sprintf(`<dc:identifier id="BookId">%s</dc:identifier>`, *eb.metadata.Identifier))
-	} else {
-		metadata = append(metadata, `<dc:identifier id="BookId">BookId</dc:identifier>`)
-	}
+	metadata = append(metadata, fmt.Sprintf(`<dc:identifier id="BookId">%s</dc:identifier>`, eb.identifier()))
 	for _, subject := range eb.metadata.Subject {
-		metadata = append(metadata, fmt.Sprintf(`<dc:subject>%s</dc:subject>`, subject))
+		if subject != "" {
+			metadata = append(metadata, fmt.Sprintf(`<dc:subject>%s</dc:subject>`, subject))
+		}
 	}
 	// metadata = append(metadata, strings.Join(eb.metadata.Subject, "\n\t\t"))
 	metadata = append(metadata, fmt.Sprintf(`<meta property="dcterms:modified">%s</meta>`, getTime()))
@@ -383,9 +551,26 @@ func (eb *EpubBuilder) getMetadataXml() string {
 	if eb.metadata.Index != nil {
 		metadata = append(metadata, fmt.Sprintf(`<meta name="calibre:series_index" content="%d"/>`, *eb.metadata.Index))
 	}
+	if eb.identity != "" {
+		metadata = append(metadata, fmt.Sprintf(`<meta name="%s" content="%s"/>`, epubIdentityMeta, escapeEpubText(eb.identity)))
+	}
+	if eb.fixedLayout {
+		metadata = append(metadata,
+			`<meta property="rendition:layout">pre-paginated</meta>`,
+			`<meta property="rendition:orientation">auto</meta>`,
+			`<meta property="rendition:spread">landscape</meta>`)
+	}
 	return strings.Join(metadata, "\n    ")
 }
 
+// identifier 返回 OPF 和 NCX 共用的唯一标识
+func (eb *EpubBuilder) identifier() string {
+	if eb.metadata.Identifier != nil {
+		return *eb.metadata.Identifier
+	}
+	return "BookId"
+}
+
 func (eb *EpubBuilder) buildContainer() string {
 	return `<?xml version="1.0" encoding="UTF-8"?>
 <container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
@@ -416,24 +601,40 @@ func (eb *EpubBuilder) buildXhtml(title, body string) string {
 </html>`, title, titleTag, body)
 }
 
+// chapterPage 返回章节第一页的文件名
+func (eb *EpubBuilder) chapterPage(i int) string {
+	if i < len(eb.chapterPages) {
+		return eb.numFill(eb.chapterPages[i])
+	}
+	return eb.numFill(i + 1)
+}
+
 func (eb *EpubBuilder) numFill(num int) string {
 	return fmt.Sprintf("%03d", num)
 }
 
 func (eb *EpubBuilder) buildCoverXhtml() string {
+	// 固定版式的页面需要声明视口
+	viewport := ""
+	if eb.fixedLayout {
+		viewport = fmt.Sprintf(`
+  <meta name="viewport" content="width=%d, height=%d"/>
+  <style type="text/css">html, body { margin: 0; padding: 0; } img { display: block; width: %dpx; height: %dpx; }</style>`,
+			eb.cover.width, eb.cover.height, eb.cover.width, eb.cover.height)
+	}
 	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE html>
 
 <html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
 <head>
-  <title>Cover</title>
+  <title>Cover</title>%s
 </head>
 <body>
   <div style="text-align: center; padding: 0pt; margin: 0pt;">
     <img src="../Images/000%s" alt="cover" />
   </div>
 </body>
-</html>`, eb.extList[0])
+</html>`, viewport, eb.extList[0])
 }
 
 func (eb *EpubBuilder) buildNavXhtml() string {
@@ -443,7 +644,7 @@ func (eb *EpubBuilder) buildNavXhtml() string {
 	}
 	var navMap []string
 	for i := 0; i < len(eb.chapterList); i++ {
-		navMap = append(navMap, fmt.Sprintf("<li><a href=\"%s.xhtml\">%s</a></li>", eb.numFill(i+1), eb.chapterList[i]))
+		navMap = append(navMap, fmt.Sprintf("<li><a href=\"%s.xhtml\">%s</a></li>", eb.chapterPage(i), eb.chapterList[i]))
 	}
 	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
 <!DOCTYPE html>
@@ -520,5 +721,7 @@ func escapeEpubText(input string) string {
 	input = strings.ReplaceAll(input, "&", "&amp;")
 	input = strings.ReplaceAll(input, "<", "&lt;")
 	input = strings.ReplaceAll(input, ">", "&gt;")
+	// 转义后的文本也会写入 content="..." 属性
+	input = strings.ReplaceAll(input, `"`, "&quot;")
 	return input
 }
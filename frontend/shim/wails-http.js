@@ -0,0 +1,130 @@
+// 在浏览器中打开服务器模式的界面时替代 Wails 注入的 window.go 和 window.runtime,
+// 绑定方法通过 HTTP 接口调用, 事件通过 Server-Sent Events 接收
+(function () {
+    const tokenKey = 'copymanga-downloader-token';
+
+    // 首次访问时从 ?token= 读取令牌并保存
+    const params = new URLSearchParams(window.location.search);
+    if (params.has('token')) {
+        localStorage.setItem(tokenKey, params.get('token'));
+        params.delete('token');
+        const query = params.toString();
+        history.replaceState(null, '', window.location.pathname + (query ? '?' + query : '') + window.location.hash);
+    }
+
+    const getToken = () => {
+        let token = localStorage.getItem(tokenKey);
+        if (!token) {
+            token = window.prompt('请输入访问令牌') || '';
+            localStorage.setItem(tokenKey, token);
+        }
+        return token;
+    };
+
+    // 与 Wails 一致: 成功时返回结果, 失败时以错误信息 reject
+    const call = async (name, args) => {
+        const response = await fetch('/api/bindings/' + name, {
+            method: 'POST',
+            headers: {
+                'Authorization': 'Bearer ' + getToken(),
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(args),
+        });
+        if (response.status === 401) {
+            localStorage.removeItem(tokenKey);
+        }
+        const text = await response.text();
+        const result = text ? JSON.parse(text) : null;
+        if (!response.ok) {
+            throw result && result.error ? result.error : response.statusText;
+        }
+        return result;
+    };
+
+    const binding = (pkg, struct) => new Proxy({}, {
+        get: (_, method) => (...args) => call(pkg + '.' + struct + '.' + method, args),
+    });
+
+    window.go = {
+        main: {
+            Config: binding('main', 'Config'),
+            DownloaderManager: binding('main', 'DownloaderManager'),
+            SubscriptionManager: binding('main', 'SubscriptionManager'),
+            Library: binding('main', 'Library'),
+        },
+    };
+
+    // 事件监听, 所有事件共用一个 EventSource
+    const listeners = {};
+    const sources = {};
+    let eventSource = null;
+
+    const connect = () => {
+        if (!eventSource) {
+            eventSource = new EventSource('/api/events?token=' + encodeURIComponent(getToken()));
+        }
+        return eventSource;
+    };
+
+    const dispatch = (eventName, data) => {
+        for (const listener of [...(listeners[eventName] || [])]) {
+            listener.callback(data);
+            if (listener.remaining > 0 && --listener.remaining === 0) {
+                remove(eventName, listener);
+            }
+        }
+    };
+
+    const remove = (eventName, listener) => {
+        listeners[eventName] = (listeners[eventName] || []).filter((item) => item !== listener);
+    };
+
+    const on = (eventName, callback, maxCallbacks) => {
+        if (!sources[eventName]) {
+            sources[eventName] = (event) => dispatch(eventName, JSON.parse(event.data));
+            connect().addEventListener(eventName, sources[eventName]);
+        }
+        const listener = { callback, remaining: maxCallbacks };
+        (listeners[eventName] = listeners[eventName] || []).push(listener);
+        return () => remove(eventName, listener);
+    };
+
+    const off = (...eventNames) => {
+        for (const eventName of eventNames) {
+            delete listeners[eventName];
+            if (sources[eventName]) {
+                eventSource.removeEventListener(eventName, sources[eventName]);
+                delete sources[eventName];
+            }
+        }
+    };
+
+    const runtime = {
+        EventsOnMultiple: on,
+        EventsOn: (eventName, callback) => on(eventName, callback, -1),
+        EventsOnce: (eventName, callback) => on(eventName, callback, 1),
+        EventsOff: off,
+        EventsOffAll: () => off(...Object.keys(listeners)),
+        EventsEmit: (eventName, ...data) => dispatch(eventName, data.length === 1 ? data[0] : data),
+        LogPrint: console.log,
+        LogTrace: console.debug,
+        LogDebug: console.debug,
+        LogInfo: console.info,
+        LogWarning: console.warn,
+        LogError: console.error,
+        LogFatal: console.error,
+        BrowserOpenURL: (url) => window.open(url, '_blank'),
+        WindowReload: () => window.location.reload(),
+        WindowReloadApp: () => window.location.reload(),
+        WindowSetTitle: (title) => { document.title = title; },
+        Environment: async () => ({ buildType: 'production', platform: 'browser', arch: '' }),
+        ClipboardGetText: () => navigator.clipboard.readText(),
+        ClipboardSetText: (text) => navigator.clipboard.writeText(text).then(() => true),
+    };
+
+    // 其余窗口相关的方法在浏览器中没有意义, 调用时忽略
+    window.runtime = new Proxy(runtime, {
+        get: (target, name) => target[name] || (() => undefined),
+    });
+})();
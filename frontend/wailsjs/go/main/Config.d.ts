@@ -7,3 +7,5 @@ export function GetConfig():Promise<main.Config>;
 export function Save():Promise<void>;
 
 export function SaveConfig(arg1:main.Config):Promise<void>;
+
+export function SetSeriesOption(arg1:string,arg2:main.SeriesOption):Promise<void>;
@@ -13,3 +13,7 @@ export function Save() {
 export function SaveConfig(arg1) {
   return window['go']['main']['Config']['SaveConfig'](arg1);
 }
+
+export function SetSeriesOption(arg1, arg2) {
+  return window['go']['main']['Config']['SetSeriesOption'](arg1, arg2);
+}
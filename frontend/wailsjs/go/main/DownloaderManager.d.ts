@@ -1,19 +1,46 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
+import {time} from '../models';
+
+export function ApplyImport(arg1:Array<main.ImportEntry>):Promise<main.ImportResult>;
+
+export function BuildOmnibus():Promise<string>;
+
+export function CheckUpstreamChanges(arg1:string,arg2:boolean):Promise<main.UpstreamChanges>;
 
 export function ClearDownloaders():Promise<void>;
 
+export function DownloadBundle(arg1:Array<number>,arg2:string):Promise<void>;
+
 export function DownloadList(arg1:Array<number>):Promise<void>;
 
 export function GetBookInfo():Promise<main.BookInfo>;
 
 export function GetComicChapter():Promise<Array<main.ChapterInfo>>;
 
-export function GetDownloader(arg1:string):Promise<void>;
+export function GetDownloader(arg1:string):Promise<main.ResolvedInput>;
 
 export function GetDownloaders():Promise<Array<main.DownloaderSingle>>;
 
-export function ProcessSend():Promise<void>;
+export function GetSchedulerState():Promise<main.SchedulerState>;
+
+export function PreviewImport(arg1:string):Promise<Array<main.ImportEntry>>;
+
+export function PreviewImportText(arg1:string,arg2:string):Promise<Array<main.ImportEntry>>;
+
+export function QueueChapter(arg1:string,arg2:string):Promise<void>;
+
+export function ScanLibrary():Promise<main.ScanResult>;
 
 export function Search(arg1:string,arg2:number):Promise<Array<main.Comic>>;
+
+export function SelectChapters(arg1:string):Promise<main.ChapterSelection>;
+
+export function SelectImportFile():Promise<string>;
+
+export function SetComicNotBefore(arg1:string,arg2:time.Time):Promise<void>;
+
+export function SetTaskNotBefore(arg1:number,arg2:time.Time):Promise<void>;
+
+export function VerifyLibrary(arg1:boolean):Promise<main.VerifyResult>;
@@ -2,10 +2,26 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ApplyImport(arg1) {
+  return window['go']['main']['DownloaderManager']['ApplyImport'](arg1);
+}
+
+export function BuildOmnibus() {
+  return window['go']['main']['DownloaderManager']['BuildOmnibus']();
+}
+
+export function CheckUpstreamChanges(arg1, arg2) {
+  return window['go']['main']['DownloaderManager']['CheckUpstreamChanges'](arg1, arg2);
+}
+
 export function ClearDownloaders() {
   return window['go']['main']['DownloaderManager']['ClearDownloaders']();
 }
 
+export function DownloadBundle(arg1, arg2) {
+  return window['go']['main']['DownloaderManager']['DownloadBundle'](arg1, arg2);
+}
+
 export function DownloadList(arg1) {
   return window['go']['main']['DownloaderManager']['DownloadList'](arg1);
 }
@@ -26,10 +42,46 @@ export function GetDownloaders() {
   return window['go']['main']['DownloaderManager']['GetDownloaders']();
 }
 
-export function ProcessSend() {
-  return window['go']['main']['DownloaderManager']['ProcessSend']();
+export function GetSchedulerState() {
+  return window['go']['main']['DownloaderManager']['GetSchedulerState']();
+}
+
+export function PreviewImport(arg1) {
+  return window['go']['main']['DownloaderManager']['PreviewImport'](arg1);
+}
+
+export function PreviewImportText(arg1, arg2) {
+  return window['go']['main']['DownloaderManager']['PreviewImportText'](arg1, arg2);
+}
+
+export function QueueChapter(arg1, arg2) {
+  return window['go']['main']['DownloaderManager']['QueueChapter'](arg1, arg2);
+}
+
+export function ScanLibrary() {
+  return window['go']['main']['DownloaderManager']['ScanLibrary']();
 }
 
 export function Search(arg1, arg2) {
   return window['go']['main']['DownloaderManager']['Search'](arg1, arg2);
 }
+
+export function SelectChapters(arg1) {
+  return window['go']['main']['DownloaderManager']['SelectChapters'](arg1);
+}
+
+export function SelectImportFile() {
+  return window['go']['main']['DownloaderManager']['SelectImportFile']();
+}
+
+export function SetComicNotBefore(arg1, arg2) {
+  return window['go']['main']['DownloaderManager']['SetComicNotBefore'](arg1, arg2);
+}
+
+export function SetTaskNotBefore(arg1, arg2) {
+  return window['go']['main']['DownloaderManager']['SetTaskNotBefore'](arg1, arg2);
+}
+
+export function VerifyLibrary(arg1) {
+  return window['go']['main']['DownloaderManager']['VerifyLibrary'](arg1);
+}
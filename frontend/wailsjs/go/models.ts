@@ -1,12 +1,18 @@
 export namespace main {
 	
 	export class BookInfo {
+	    UUID: string;
 	    Series: string;
 	    Author: string;
 	    Description: string;
 	    Genre: string;
 	    Title: string;
 	    Cover: string;
+	    Tags: string[];
+	    Region: number;
+	    RegionName: string;
+	    Finished: boolean;
+	    Restrict: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new BookInfo(source);
@@ -14,12 +20,18 @@ export namespace main {
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.UUID = source["UUID"];
 	        this.Series = source["Series"];
 	        this.Author = source["Author"];
 	        this.Description = source["Description"];
 	        this.Genre = source["Genre"];
 	        this.Title = source["Title"];
 	        this.Cover = source["Cover"];
+	        this.Tags = source["Tags"];
+	        this.Region = source["Region"];
+	        this.RegionName = source["RegionName"];
+	        this.Finished = source["Finished"];
+	        this.Restrict = source["Restrict"];
 	    }
 	}
 	export class ChapterInfo {
@@ -28,6 +40,11 @@ export namespace main {
 	    count: number;
 	    size: number;
 	    name: string;
+	    type: number;
+	    group_path_word: string;
+	    datetime_created: string;
+	    local: boolean;
+	    changed: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new ChapterInfo(source);
@@ -40,8 +57,45 @@ export namespace main {
 	        this.count = source["count"];
 	        this.size = source["size"];
 	        this.name = source["name"];
+	        this.type = source["type"];
+	        this.group_path_word = source["group_path_word"];
+	        this.datetime_created = source["datetime_created"];
+	        this.local = source["local"];
+	        this.changed = source["changed"];
 	    }
 	}
+	export class ChapterSelection {
+	    chapters: ChapterInfo[];
+	    selected: number[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ChapterSelection(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.chapters = this.convertValues(source["chapters"], ChapterInfo);
+	        this.selected = source["selected"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class Display {
 	    value: number;
 	    display: string;
@@ -79,6 +133,8 @@ export namespace main {
 	    theme: PathWord[];
 	    brief: string;
 	    region: Display;
+	    status: Display;
+	    restrict: Display;
 	
 	    static createFrom(source: any = {}) {
 	        return new Comic(source);
@@ -94,6 +150,56 @@ export namespace main {
 	        this.theme = this.convertValues(source["theme"], PathWord);
 	        this.brief = source["brief"];
 	        this.region = this.convertValues(source["region"], Display);
+	        this.status = this.convertValues(source["status"], Display);
+	        this.restrict = this.convertValues(source["restrict"], Display);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class TimeWindow {
+	    weekday: number;
+	    start: string;
+	    end: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TimeWindow(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.weekday = source["weekday"];
+	        this.start = source["start"];
+	        this.end = source["end"];
+	    }
+	}
+	export class ScheduleConfig {
+	    enabled: boolean;
+	    windows: TimeWindow[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ScheduleConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.windows = this.convertValues(source["windows"], TimeWindow);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -114,6 +220,20 @@ export namespace main {
 		    return a;
 		}
 	}
+	export class SeriesOption {
+	    imageQuality: string;
+	    preferWebp?: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new SeriesOption(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.imageQuality = source["imageQuality"];
+	        this.preferWebp = source["preferWebp"];
+	    }
+	}
 	export class User {
 	    username: string;
 	    password: string;
@@ -136,6 +256,16 @@ export namespace main {
 	    packageType: string;
 	    userList: User[];
 	    namingStyle: string;
+	    progressInterval: number;
+	    imageCheck: string;
+	    imageQuality: string;
+	    preferWebp: boolean;
+	    seriesOptions: Record<string, SeriesOption>;
+	    schedule?: ScheduleConfig;
+	    subscriptionInterval: number;
+	    versionRetention: number;
+	    compression: string;
+	    serverToken: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new Config(source);
@@ -148,6 +278,16 @@ export namespace main {
 	        this.packageType = source["packageType"];
 	        this.userList = this.convertValues(source["userList"], User);
 	        this.namingStyle = source["namingStyle"];
+	        this.progressInterval = source["progressInterval"];
+	        this.imageCheck = source["imageCheck"];
+	        this.imageQuality = source["imageQuality"];
+	        this.preferWebp = source["preferWebp"];
+	        this.seriesOptions = this.convertValues(source["seriesOptions"], SeriesOption, true);
+	        this.schedule = this.convertValues(source["schedule"], ScheduleConfig);
+	        this.subscriptionInterval = source["subscriptionInterval"];
+	        this.versionRetention = source["versionRetention"];
+	        this.compression = source["compression"];
+	        this.serverToken = source["serverToken"];
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -170,10 +310,14 @@ export namespace main {
 	}
 	
 	export class DownloaderSingle {
+	    id: number;
 	    pathWord: string;
+	    group: string;
 	    chapter?: ChapterInfo;
 	    bookInfo?: BookInfo;
 	    progress: number;
+	    state: string;
+	    notBefore: time.Time;
 	
 	    static createFrom(source: any = {}) {
 	        return new DownloaderSingle(source);
@@ -181,10 +325,280 @@ export namespace main {
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
 	        this.pathWord = source["pathWord"];
+	        this.group = source["group"];
 	        this.chapter = this.convertValues(source["chapter"], ChapterInfo);
 	        this.bookInfo = this.convertValues(source["bookInfo"], BookInfo);
 	        this.progress = source["progress"];
+	        this.state = source["state"];
+	        this.notBefore = this.convertValues(source["notBefore"], time.Time);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ImportEntry {
+	    line: number;
+	    input: string;
+	    selection: string;
+	    format: string;
+	    pathWord: string;
+	    chapterUUID: string;
+	    name: string;
+	    candidates: Comic[];
+	    status: string;
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ImportEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.line = source["line"];
+	        this.input = source["input"];
+	        this.selection = source["selection"];
+	        this.format = source["format"];
+	        this.pathWord = source["pathWord"];
+	        this.chapterUUID = source["chapterUUID"];
+	        this.name = source["name"];
+	        this.candidates = this.convertValues(source["candidates"], Comic);
+	        this.status = source["status"];
+	        this.error = source["error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ImportResult {
+	    queued: number;
+	    failed: ImportEntry[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ImportResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.queued = source["queued"];
+	        this.failed = this.convertValues(source["failed"], ImportEntry);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class LibraryChapter {
+	    uuid: string;
+	    name: string;
+	    index: number;
+	    group: string;
+	    format: string;
+	    filePath: string;
+	    pageCount: number;
+	    size: number;
+	    hash: string;
+	    downloadedAt: time.Time;
+	    remoteSize: number;
+	    upstreamChanged: boolean;
+	    variants?: string[];
+	    pageFingerprints?: string[];
+	    bundle: string;
+	    problem: string;
+	    verifiedAt: time.Time;
+	
+	    static createFrom(source: any = {}) {
+	        return new LibraryChapter(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.uuid = source["uuid"];
+	        this.name = source["name"];
+	        this.index = source["index"];
+	        this.group = source["group"];
+	        this.format = source["format"];
+	        this.filePath = source["filePath"];
+	        this.pageCount = source["pageCount"];
+	        this.size = source["size"];
+	        this.hash = source["hash"];
+	        this.downloadedAt = this.convertValues(source["downloadedAt"], time.Time);
+	        this.remoteSize = source["remoteSize"];
+	        this.upstreamChanged = source["upstreamChanged"];
+	        this.variants = source["variants"];
+	        this.pageFingerprints = source["pageFingerprints"];
+	        this.bundle = source["bundle"];
+	        this.problem = source["problem"];
+	        this.verifiedAt = this.convertValues(source["verifiedAt"], time.Time);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class LibrarySeries {
+	    uuid: string;
+	    pathWord: string;
+	    series: string;
+	    chapterCount: number;
+	    size: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new LibrarySeries(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.uuid = source["uuid"];
+	        this.pathWord = source["pathWord"];
+	        this.series = source["series"];
+	        this.chapterCount = source["chapterCount"];
+	        this.size = source["size"];
+	    }
+	}
+	
+	export class ResolvedInput {
+	    pathWord: string;
+	    chapterUUID: string;
+	    queued: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ResolvedInput(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.pathWord = source["pathWord"];
+	        this.chapterUUID = source["chapterUUID"];
+	        this.queued = source["queued"];
+	    }
+	}
+	export class ScanIssue {
+	    filePath: string;
+	    reason: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ScanIssue(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.filePath = source["filePath"];
+	        this.reason = source["reason"];
+	    }
+	}
+	export class ScanResult {
+	    added: number;
+	    skipped: number;
+	    unmatched: ScanIssue[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ScanResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.added = source["added"];
+	        this.skipped = source["skipped"];
+	        this.unmatched = this.convertValues(source["unmatched"], ScanIssue);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class SchedulerState {
+	    state: string;
+	    queued: number;
+	    running: number;
+	    inWindow: boolean;
+	    updated: time.Time;
+	
+	    static createFrom(source: any = {}) {
+	        return new SchedulerState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.state = source["state"];
+	        this.queued = source["queued"];
+	        this.running = source["running"];
+	        this.inWindow = source["inWindow"];
+	        this.updated = this.convertValues(source["updated"], time.Time);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -206,6 +620,175 @@ export namespace main {
 		}
 	}
 	
+	export class Subscription {
+	    pathWord: string;
+	    name: string;
+	    group: string;
+	    packageType: string;
+	    namingStyle: string;
+	    selection: string;
+	    refetchChanged: boolean;
+	    downloaded: string[];
+	    lastCheck: time.Time;
+	    lastError: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Subscription(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.pathWord = source["pathWord"];
+	        this.name = source["name"];
+	        this.group = source["group"];
+	        this.packageType = source["packageType"];
+	        this.namingStyle = source["namingStyle"];
+	        this.selection = source["selection"];
+	        this.refetchChanged = source["refetchChanged"];
+	        this.downloaded = source["downloaded"];
+	        this.lastCheck = this.convertValues(source["lastCheck"], time.Time);
+	        this.lastError = source["lastError"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class UpstreamChanges {
+	    changed: LibraryChapter[];
+	    requeued: number;
+	    bundled: LibraryChapter[];
+	
+	    static createFrom(source: any = {}) {
+	        return new UpstreamChanges(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.changed = this.convertValues(source["changed"], LibraryChapter);
+	        this.requeued = source["requeued"];
+	        this.bundled = this.convertValues(source["bundled"], LibraryChapter);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class VerifyIssue {
+	    comicUUID: string;
+	    pathWord: string;
+	    series: string;
+	    chapterUUID: string;
+	    name: string;
+	    group: string;
+	    format: string;
+	    filePath: string;
+	    bundle: string;
+	    problem: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new VerifyIssue(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.comicUUID = source["comicUUID"];
+	        this.pathWord = source["pathWord"];
+	        this.series = source["series"];
+	        this.chapterUUID = source["chapterUUID"];
+	        this.name = source["name"];
+	        this.group = source["group"];
+	        this.format = source["format"];
+	        this.filePath = source["filePath"];
+	        this.bundle = source["bundle"];
+	        this.problem = source["problem"];
+	    }
+	}
+	export class VerifyResult {
+	    checked: number;
+	    broken: VerifyIssue[];
+	    warnings: VerifyIssue[];
+	    requeued: number;
+	    bundled: VerifyIssue[];
+	
+	    static createFrom(source: any = {}) {
+	        return new VerifyResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.checked = source["checked"];
+	        this.broken = this.convertValues(source["broken"], VerifyIssue);
+	        this.warnings = this.convertValues(source["warnings"], VerifyIssue);
+	        this.requeued = source["requeued"];
+	        this.bundled = this.convertValues(source["bundled"], VerifyIssue);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace time {
+	
+	export class Time {
+	
+	
+	    static createFrom(source: any = {}) {
+	        return new Time(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	
+	    }
+	}
 
 }
 
@@ -4,7 +4,11 @@ go 1.22.0
 
 toolchain go1.24.0
 
-require github.com/wailsapp/wails/v2 v2.10.0
+require (
+	github.com/google/uuid v1.6.0
+	github.com/wailsapp/wails/v2 v2.10.0
+	golang.org/x/image v0.18.0
+)
 
 require (
 	github.com/tidwall/match v1.1.1 // indirect
@@ -15,7 +19,6 @@ require (
 	github.com/bep/debounce v1.2.1 // indirect
 	github.com/go-ole/go-ole v1.3.0 // indirect
 	github.com/godbus/dbus/v5 v5.1.0 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/jchv/go-winloader v0.0.0-20210711035445-715c2860da7e // indirect
 	github.com/labstack/echo/v4 v4.13.3 // indirect
 	github.com/labstack/gommon v0.4.2 // indirect
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+
+	_ "golang.org/x/image/webp"
+)
+
+// 图片校验模式
+const (
+	ImageCheckMagic  = "magic"  // 只检查文件头的魔数
+	ImageCheckHeader = "header" // 解析图片头并检查文件结尾是否完整, 默认模式
+	ImageCheckFull   = "full"   // 完整解码整张图片
+)
+
+// PageInfo 记录单页图片的信息, 供打包时使用
+type PageInfo struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+	// 实际下载的分辨率
+	Variant string `json:"variant"`
+}
+
+// decodesImages 判断打包格式是否需要解析图片尺寸或重新编码.
+// 这些格式不支持 AVIF 等没有解码器的图片
+func decodesImages(packageType string) bool {
+	switch packageType {
+	case "epub", "kepub", "pdf", "mobi", "azw3":
+		return true
+	}
+	return false
+}
+
+// validateImageFile 按 mode 校验磁盘上的图片文件
+func validateImageFile(path string, mode string) (PageInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return PageInfo{}, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return PageInfo{}, err
+	}
+	info, err := checkImage(file, stat.Size(), mode)
+	info.Name = filepath.Base(path)
+	return info, err
+}
+
+// checkImage 校验图片数据并返回其格式和尺寸.
+// magic 模式下解析图片头失败不视为错误, 只是拿不到尺寸
+func checkImage(r io.ReadSeeker, size int64, mode string) (PageInfo, error) {
+	info := PageInfo{Size: size}
+
+	head := make([]byte, 32)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return info, err
+	}
+	if !isImage(head[:n]) {
+		return info, fmt.Errorf("unknown image format")
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return info, err
+	}
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		if mode == ImageCheckHeader || mode == ImageCheckFull {
+			// AVIF 等没有解码器的格式只能做魔数检查
+			if err == image.ErrFormat {
+				return info, nil
+			}
+			return info, fmt.Errorf("invalid image header: %v", err)
+		}
+		return info, nil
+	}
+	info.Format = format
+	info.Width = config.Width
+	info.Height = config.Height
+
+	switch mode {
+	case ImageCheckHeader:
+		if err := checkImageTrailer(r, size, format); err != nil {
+			return info, err
+		}
+	case ImageCheckFull:
+		if err := checkImageTrailer(r, size, format); err != nil {
+			return info, err
+		}
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return info, err
+		}
+		if _, _, err := image.Decode(r); err != nil {
+			return info, fmt.Errorf("failed to decode image: %v", err)
+		}
+	}
+	return info, nil
+}
+
+// checkImageTrailer 检查图片结尾, 识别被截断的文件
+func checkImageTrailer(r io.ReadSeeker, size int64, format string) error {
+	tailSize := int64(64)
+	if size < tailSize {
+		tailSize = size
+	}
+	if _, err := r.Seek(size-tailSize, io.SeekStart); err != nil {
+		return err
+	}
+	tail := make([]byte, tailSize)
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return err
+	}
+
+	switch format {
+	case "jpeg":
+		// 部分编码器会在 EOI 之后填充空字节
+		if !bytes.HasSuffix(bytes.TrimRight(tail, "\x00\r\n"), []byte{0xFF, 0xD9}) {
+			return fmt.Errorf("jpeg is truncated: missing EOI marker")
+		}
+	case "png":
+		if !bytes.HasSuffix(tail, []byte{'I', 'E', 'N', 'D', 0xAE, 0x42, 0x60, 0x82}) {
+			return fmt.Errorf("png is truncated: missing IEND chunk")
+		}
+	case "gif":
+		if !bytes.HasSuffix(bytes.TrimRight(tail, "\x00"), []byte{0x3B}) {
+			return fmt.Errorf("gif is truncated: missing trailer")
+		}
+	case "webp":
+		if _, err := r.Seek(4, io.SeekStart); err != nil {
+			return err
+		}
+		var riffSize uint32
+		if err := binary.Read(r, binary.LittleEndian, &riffSize); err != nil {
+			return err
+		}
+		if int64(riffSize)+8 > size {
+			return fmt.Errorf("webp is truncated: expected %d bytes, got %d", int64(riffSize)+8, size)
+		}
+	}
+	return nil
+}
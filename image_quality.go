@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+)
+
+// 图片分辨率, 从高到低排列
+const (
+	ImageQualityOriginal = "original"
+	ImageQualityC1500    = "c1500x"
+	ImageQualityC800     = "c800x"
+)
+
+var imageQualities = []string{ImageQualityOriginal, ImageQualityC1500, ImageQualityC800}
+
+var imageSizePattern = regexp.MustCompile(`\.c\d+x\.(\w+)$`)
+
+var errImageNotFound = errors.New("image not found")
+
+type imageVariant struct {
+	Quality string
+	URL     string
+}
+
+// imageVariants 返回从 quality 开始逐级降低分辨率的候选地址,
+// 高分辨率不存在时依次回退
+func imageVariants(url string, quality string) []imageVariant {
+	match := imageSizePattern.FindStringSubmatchIndex(url)
+	if match == nil {
+		return []imageVariant{{URL: url}}
+	}
+	base := url[:match[0]]
+	ext := url[match[2]:match[3]]
+
+	start := 0
+	for i, q := range imageQualities {
+		if q == quality {
+			start = i
+			break
+		}
+	}
+
+	var variants []imageVariant
+	for _, q := range imageQualities[start:] {
+		if q == ImageQualityOriginal {
+			variants = append(variants, imageVariant{Quality: q, URL: base})
+		} else {
+			variants = append(variants, imageVariant{Quality: q, URL: base + "." + q + "." + ext})
+		}
+	}
+	return variants
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 导入条目状态
+const (
+	ImportReady     = "ready"
+	ImportAmbiguous = "ambiguous" // 按标题搜索到多个结果, 需要用户确认
+	ImportError     = "error"
+)
+
+// ImportEntry 导入文件中的一行
+type ImportEntry struct {
+	Line        int    `json:"line"`
+	Input       string `json:"input"`
+	Selection   string `json:"selection"`
+	Format      string `json:"format"`
+	PathWord    string `json:"pathWord"`
+	ChapterUUID string `json:"chapterUUID"`
+	Name        string `json:"name"`
+	// 按标题搜索到的候选漫画
+	Candidates []Comic `json:"candidates"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error"`
+}
+
+type ImportResult struct {
+	Queued int            `json:"queued"`
+	Failed []*ImportEntry `json:"failed"`
+}
+
+// PreviewImport 读取 txt、csv 或 json 格式的漫画列表并逐条解析, 返回预览供用户确认.
+// txt 每行一个条目, 可用 | 或制表符分隔出章节选择和打包格式
+func (d *DownloaderManager) PreviewImport(filePath string) ([]*ImportEntry, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return d.PreviewImportText(filepath.Base(filePath), string(content))
+}
+
+// PreviewImportText 与 PreviewImport 相同, 但由前端读取文件内容,
+// name 为文件名, 用于按扩展名判断格式
+func (d *DownloaderManager) PreviewImportText(name string, content string) ([]*ImportEntry, error) {
+	var entries []*ImportEntry
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		entries, err = parseImportJson([]byte(content))
+	case ".csv":
+		entries, err = parseImportCsv([]byte(content))
+	default:
+		entries = parseImportText(content)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		resolveImportEntry(entry)
+	}
+	return entries, nil
+}
+
+func parseImportText(content string) []*ImportEntry {
+	var entries []*ImportEntry
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == '|' || r == '\t' })
+		entries = append(entries, newImportEntry(i+1, fields))
+	}
+	return entries
+}
+
+func parseImportCsv(content []byte) ([]*ImportEntry, error) {
+	reader := csv.NewReader(strings.NewReader(string(content)))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var entries []*ImportEntry
+	for i, record := range records {
+		// 跳过表头
+		if i == 0 && len(record) > 0 && strings.EqualFold(strings.TrimSpace(record[0]), "input") {
+			continue
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		entries = append(entries, newImportEntry(i+1, record))
+	}
+	return entries, nil
+}
+
+func parseImportJson(content []byte) ([]*ImportEntry, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	var entries []*ImportEntry
+	for i, item := range raw {
+		var input string
+		if err := json.Unmarshal(item, &input); err == nil {
+			entries = append(entries, newImportEntry(i+1, []string{input}))
+			continue
+		}
+		var object struct {
+			Input     string `json:"input"`
+			Selection string `json:"selection"`
+			Format    string `json:"format"`
+		}
+		if err := json.Unmarshal(item, &object); err != nil {
+			return nil, fmt.Errorf("entry %d: %v", i+1, err)
+		}
+		entries = append(entries, newImportEntry(i+1, []string{object.Input, object.Selection, object.Format}))
+	}
+	return entries, nil
+}
+
+// newImportEntry 按 输入, 章节选择, 打包格式 的顺序读取字段
+func newImportEntry(line int, fields []string) *ImportEntry {
+	entry := &ImportEntry{Line: line}
+	for i, field := range fields {
+		field = strings.TrimSpace(field)
+		switch i {
+		case 0:
+			entry.Input = field
+		case 1:
+			entry.Selection = field
+		case 2:
+			entry.Format = field
+		}
+	}
+	return entry
+}
+
+// resolveImportEntry 把输入解析为 path word, 无法识别为链接时按标题搜索
+func resolveImportEntry(entry *ImportEntry) {
+	if entry.Format != "" && !isPackageType(entry.Format) {
+		entry.Status = ImportError
+		entry.Error = "未知的打包格式: " + entry.Format
+		return
+	}
+
+	resolved, err := ResolveInput(entry.Input)
+	// 单个英文单词也可能是标题, 只有能查到漫画时才当作 path word, 否则按标题搜索
+	if err == nil && resolved.ChapterUUID == "" && rawPathWordRegexp.MatchString(strings.TrimSpace(entry.Input)) {
+		downloader := NewDownloader(ConfigInstance.UrlBase, resolved.PathWord, ConfigInstance)
+		if err = downloader.GetBookInfo(); err == nil && downloader.bookInfo.UUID == "" {
+			err = fmt.Errorf("漫画不存在: %s", resolved.PathWord)
+		}
+		entry.Name = downloader.bookInfo.Series
+	}
+	if err == nil {
+		entry.PathWord = resolved.PathWord
+		entry.ChapterUUID = resolved.ChapterUUID
+		entry.Status = ImportReady
+		return
+	}
+
+	comics, err := Search(ConfigInstance.UrlBase, entry.Input, 1)
+	if err != nil {
+		entry.Status = ImportError
+		entry.Error = err.Error()
+		return
+	}
+	var exact []Comic
+	for _, comic := range comics {
+		if comic.Name == entry.Input {
+			exact = append(exact, comic)
+		}
+	}
+	switch {
+	case len(exact) == 1:
+		entry.PathWord = exact[0].PathWord
+		entry.Name = exact[0].Name
+		entry.Status = ImportReady
+	case len(comics) == 0:
+		entry.Status = ImportError
+		entry.Error = "没有找到相关漫画"
+	default:
+		entry.Candidates = comics
+		entry.Status = ImportAmbiguous
+	}
+}
+
+// ApplyImport 把确认后的条目加入下载队列. 对于有歧义的条目,
+// 调用方需要从候选中选定 PathWord 并将状态改为 ready
+func (d *DownloaderManager) ApplyImport(entries []*ImportEntry) ImportResult {
+	result := ImportResult{Failed: []*ImportEntry{}}
+	for _, entry := range entries {
+		if entry.Status != ImportReady || entry.PathWord == "" {
+			continue
+		}
+		if err := d.queueImportEntry(entry); err != nil {
+			entry.Status = ImportError
+			entry.Error = err.Error()
+			result.Failed = append(result.Failed, entry)
+			continue
+		}
+		result.Queued++
+	}
+	return result
+}
+
+func (d *DownloaderManager) queueImportEntry(entry *ImportEntry) error {
+	_, err := d.queueInput(entry.PathWord, entry.ChapterUUID, entry.Selection, entry.Format)
+	return err
+}
+
+// queueInput 把漫画中按表达式选中的章节或单个章节加入下载队列, 返回加入的任务数
+func (d *DownloaderManager) queueInput(pathWord string, chapterUUID string, selection string, packageType string) (int, error) {
+	config := ConfigInstance.withOverrides(packageType, "")
+	downloader := NewDownloader(ConfigInstance.UrlBase, pathWord, config)
+
+	if chapterUUID != "" {
+		chapter, err := downloader.GetChapterInfo(chapterUUID)
+		if err != nil {
+			return 0, err
+		}
+		if err := downloader.GetBookInfo(); err != nil {
+			return 0, err
+		}
+		d.enqueue([]*DownloaderSingle{downloader.newTask(chapter)})
+		return 1, nil
+	}
+
+	indexes, err := downloader.Select(selection)
+	if err != nil {
+		return 0, err
+	}
+	tasks := downloader.GetDownloadList(indexes)
+	d.enqueue(tasks)
+	return len(tasks), nil
+}
+
+func isPackageType(packageType string) bool {
+	return packageExt(packageType) != "" || packageType == "image"
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LibraryComic 本地已下载的漫画, 以漫画 UUID 为键
+type LibraryComic struct {
+	UUID     string                     `json:"uuid"`
+	PathWord string                     `json:"pathWord"`
+	Series   string                     `json:"series"`
+	Chapters map[string]*LibraryChapter `json:"chapters"`
+}
+
+// LibraryChapter 本地已下载的章节, 以章节 UUID 为键
+type LibraryChapter struct {
+	UUID         string    `json:"uuid"`
+	Name         string    `json:"name"`
+	Index        int       `json:"index"`
+	Group        string    `json:"group"`
+	Format       string    `json:"format"`
+	FilePath     string    `json:"filePath"`
+	PageCount    int       `json:"pageCount"`
+	Size         int64     `json:"size"`
+	Hash         string    `json:"hash"`
+	DownloadedAt time.Time `json:"downloadedAt"`
+	// 下载时远端记录的页数, 用于发现源站替换过的章节
+	RemoteSize      int  `json:"remoteSize"`
+	UpstreamChanged bool `json:"upstreamChanged"`
+	// 每页实际下载的分辨率, 顺序与页面一致, 用于发现降级下载的页面
+	Variants []string `json:"variants,omitempty"`
+	// 下载时每页远端图片的指纹, 用于发现页数不变但图片被替换的章节
+	PageFingerprints []string `json:"pageFingerprints,omitempty"`
+	// 合并下载时所在文件的标题, 同一文件中的章节共用 FilePath, 为空表示单独的文件
+	Bundle string `json:"bundle"`
+	// 最近一次校验发现的问题, 为空表示正常
+	Problem    string    `json:"problem"`
+	VerifiedAt time.Time `json:"verifiedAt"`
+}
+
+// LibrarySeries 漫画的汇总信息
+type LibrarySeries struct {
+	UUID         string `json:"uuid"`
+	PathWord     string `json:"pathWord"`
+	Series       string `json:"series"`
+	ChapterCount int    `json:"chapterCount"`
+	Size         int64  `json:"size"`
+}
+
+type Library struct {
+	mu     sync.Mutex
+	path   string
+	comics map[string]*LibraryComic
+}
+
+var LibraryInstance *Library = LoadLibrary("library.json")
+
+func LoadLibrary(path string) *Library {
+	library := &Library{
+		path:   path,
+		comics: make(map[string]*LibraryComic),
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return library
+	}
+	err = json.Unmarshal(content, &library.comics)
+	if err != nil {
+		fmt.Fprintln(logOutput, "Error deserializing library:", err)
+		library.comics = make(map[string]*LibraryComic)
+	}
+	return library
+}
+
+// save 需要在持有 mu 时调用
+func (l *Library) save() {
+	content, err := json.MarshalIndent(l.comics, "", "  ")
+	if err != nil {
+		fmt.Fprintln(logOutput, "Error serializing library:", err)
+		return
+	}
+	err = atomicWriteFile(l.path, func(f *os.File) error {
+		_, err := f.Write(content)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintln(logOutput, "Error writing library file:", err)
+	}
+}
+
+// findComic 按漫画 UUID 查找, 找不到时按 path word 查找
+func (l *Library) findComic(comicUUID string, pathWord string) *LibraryComic {
+	if comic, ok := l.comics[comicUUID]; ok && comicUUID != "" {
+		return comic
+	}
+	if pathWord == "" {
+		return nil
+	}
+	for _, comic := range l.comics {
+		if comic.PathWord == pathWord {
+			return comic
+		}
+	}
+	return nil
+}
+
+// record 记录下载完成的章节, filePath 为打包后的文件或图片目录
+func (l *Library) record(task *DownloaderSingle, filePath string, pages []PageInfo) error {
+	size, hash, err := fileDigest(filePath)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recordChapter(task.BookInfo.UUID, task.PathWord, task.BookInfo.Series, &LibraryChapter{
+		UUID:             task.Chapter.UUID,
+		Name:             task.Chapter.Name,
+		Index:            task.Chapter.Index,
+		Group:            task.Group,
+		Format:           task.config.PackageType,
+		FilePath:         filePath,
+		PageCount:        len(pages),
+		Size:             size,
+		Hash:             hash,
+		DownloadedAt:     time.Now(),
+		RemoteSize:       task.Chapter.Size,
+		Variants:         pageVariants(pages),
+		PageFingerprints: task.fingerprints,
+	})
+	l.save()
+	return nil
+}
+
+// recordBundle 记录合并下载的章节, 所有章节指向同一个文件, 页数为整个文件的页数
+func (l *Library) recordBundle(bundle *Bundle, pageCount int) error {
+	size, hash, err := fileDigest(bundle.path)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, task := range bundle.tasks {
+		l.recordChapter(task.BookInfo.UUID, task.PathWord, task.BookInfo.Series, &LibraryChapter{
+			UUID:             task.Chapter.UUID,
+			Name:             task.Chapter.Name,
+			Index:            task.Chapter.Index,
+			Group:            task.Group,
+			Format:           bundle.config.PackageType,
+			FilePath:         bundle.path,
+			PageCount:        pageCount,
+			Size:             size,
+			Hash:             hash,
+			DownloadedAt:     time.Now(),
+			RemoteSize:       task.Chapter.Size,
+			Bundle:           bundle.Title,
+			Variants:         pageVariants(task.pages),
+			PageFingerprints: task.fingerprints,
+		})
+	}
+	l.save()
+	return nil
+}
+
+// pageVariants 返回每页下载的分辨率, 图片地址中没有分辨率时返回 nil
+func pageVariants(pages []PageInfo) []string {
+	variants := make([]string, len(pages))
+	known := false
+	for i, page := range pages {
+		variants[i] = page.Variant
+		known = known || page.Variant != ""
+	}
+	if !known {
+		return nil
+	}
+	return variants
+}
+
+// recordChapter 需要在持有 mu 时调用
+func (l *Library) recordChapter(comicUUID string, pathWord string, series string, chapter *LibraryChapter) {
+	comic := l.findComic(comicUUID, pathWord)
+	if comic == nil {
+		comic = &LibraryComic{
+			UUID:     comicUUID,
+			Chapters: make(map[string]*LibraryChapter),
+		}
+		key := comicUUID
+		if key == "" {
+			// 没能获取到漫画信息时退而使用 path word
+			key = pathWord
+		}
+		l.comics[key] = comic
+	}
+	comic.PathWord = pathWord
+	comic.Series = series
+	comic.Chapters[chapter.UUID] = chapter
+}
+
+// hasChapter 判断章节是否已在本地
+func (l *Library) hasChapter(comicUUID string, pathWord string, chapterUUID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	comic := l.findComic(comicUUID, pathWord)
+	if comic == nil {
+		return false
+	}
+	_, ok := comic.Chapters[chapterUUID]
+	return ok
+}
+
+// GetSeries 列出本地所有漫画
+func (l *Library) GetSeries() []LibrarySeries {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]LibrarySeries, 0, len(l.comics))
+	for _, comic := range l.comics {
+		series := LibrarySeries{
+			UUID:         comic.UUID,
+			PathWord:     comic.PathWord,
+			Series:       comic.Series,
+			ChapterCount: len(comic.Chapters),
+		}
+		// 合并下载的章节共用一个文件, 只计算一次
+		files := make(map[string]bool, len(comic.Chapters))
+		for _, chapter := range comic.Chapters {
+			if !files[chapter.FilePath] {
+				files[chapter.FilePath] = true
+				series.Size += chapter.Size
+			}
+		}
+		list = append(list, series)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Series < list[j].Series })
+	return list
+}
+
+// GetChapters 列出某部漫画在本地的章节
+func (l *Library) GetChapters(comicUUID string) []LibraryChapter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	comic, ok := l.comics[comicUUID]
+	if !ok {
+		return []LibraryChapter{}
+	}
+	list := make([]LibraryChapter, 0, len(comic.Chapters))
+	for _, chapter := range comic.Chapters {
+		list = append(list, *chapter)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Index < list[j].Index })
+	return list
+}
+
+// markLocal 标记远端章节列表中已下载到本地的章节, 以及下载后被源站更新过的章节
+func (l *Library) markLocal(comicUUID string, pathWord string, chapters []*ChapterInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	comic := l.findComic(comicUUID, pathWord)
+	for _, chapter := range chapters {
+		chapter.Local = false
+		chapter.Changed = false
+		if comic == nil {
+			continue
+		}
+		if local, ok := comic.Chapters[chapter.UUID]; ok {
+			chapter.Local = true
+			chapter.Changed = local.UpstreamChanged || upstreamChanged(local, chapter, nil)
+		}
+	}
+}
+
+// detectChanges 对比远端章节的页数和每页图片的指纹与下载时的记录, 标记并返回变化了的本地章节.
+// fingerprints 获取远端章节当前的页面指纹, 为 nil 时只比较页数
+func (l *Library) detectChanges(comicUUID string, pathWord string, chapters []*ChapterInfo, fingerprints func(*ChapterInfo) ([]string, error)) []LibraryChapter {
+	// 获取页面地址需要请求网络, 不能持有锁
+	l.mu.Lock()
+	comic := l.findComic(comicUUID, pathWord)
+	if comic == nil {
+		l.mu.Unlock()
+		return nil
+	}
+	locals := make(map[string]LibraryChapter)
+	for _, chapter := range chapters {
+		if local, ok := comic.Chapters[chapter.UUID]; ok && !local.UpstreamChanged {
+			locals[chapter.UUID] = *local
+		}
+	}
+	l.mu.Unlock()
+
+	changed := make(map[string]bool)
+	for _, chapter := range chapters {
+		local, ok := locals[chapter.UUID]
+		if !ok {
+			continue
+		}
+		var current []string
+		if fingerprints != nil && len(local.PageFingerprints) > 0 && !upstreamChanged(&local, chapter, nil) {
+			var err error
+			if current, err = fingerprints(chapter); err != nil {
+				// 多半是限速, 剩下的章节下次再比较
+				fmt.Fprintln(logOutput, "Error fetching chapter pages:", err)
+				fingerprints = nil
+			}
+		}
+		if upstreamChanged(&local, chapter, current) {
+			changed[chapter.UUID] = true
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var result []LibraryChapter
+	for _, chapter := range chapters {
+		local, ok := comic.Chapters[chapter.UUID]
+		if !ok {
+			continue
+		}
+		if changed[chapter.UUID] {
+			local.UpstreamChanged = true
+		}
+		if local.UpstreamChanged {
+			result = append(result, *local)
+		}
+	}
+	if len(changed) > 0 {
+		l.save()
+	}
+	return result
+}
+
+// upstreamChanged 判断远端章节的页数或页面指纹是否与下载时不一致, 没有记录时不比较.
+// chapter.Count 是分组的章节总数, 每次更新都会变化, 不能用来判断
+func upstreamChanged(local *LibraryChapter, remote *ChapterInfo, fingerprints []string) bool {
+	if local.RemoteSize > 0 && remote.Size > 0 && local.RemoteSize != remote.Size {
+		return true
+	}
+	return len(local.PageFingerprints) > 0 && fingerprints != nil && !slices.Equal(local.PageFingerprints, fingerprints)
+}
+
+// pageFingerprints 计算每页图片地址的指纹. 去掉域名和分辨率后缀,
+// 更换 CDN 或下载的分辨率不同不会改变指纹
+func pageFingerprints(urls []string) []string {
+	fingerprints := make([]string, len(urls))
+	for i, imageUrl := range urls {
+		if match := imageSizePattern.FindStringIndex(imageUrl); match != nil {
+			imageUrl = imageUrl[:match[0]]
+		}
+		if parsed, err := url.Parse(imageUrl); err == nil {
+			imageUrl = parsed.Path
+		}
+		sum := sha256.Sum256([]byte(imageUrl))
+		fingerprints[i] = hex.EncodeToString(sum[:6])
+	}
+	return fingerprints
+}
+
+// fileDigest 计算文件的大小和 sha256, 目录只统计大小
+func fileDigest(path string) (int64, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, "", err
+	}
+	if info.IsDir() {
+		var size int64
+		err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() {
+				size += fi.Size()
+			}
+			return nil
+		})
+		return size, "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScanResult 扫描输出目录的结果
+type ScanResult struct {
+	Added     int         `json:"added"`
+	Skipped   int         `json:"skipped"`
+	Unmatched []ScanIssue `json:"unmatched"`
+}
+
+type ScanIssue struct {
+	FilePath string `json:"filePath"`
+	Reason   string `json:"reason"`
+}
+
+// scannedFile 从已有文件中读取到的元数据
+type scannedFile struct {
+	path      string
+	format    string
+	series    string
+	title     string
+	pageCount int
+	pathWord  string
+	comicUUID string
+	// 文件所含章节的 UUID, 多于一个时为合并文件
+	chapterUUIDs []string
+	// 从 fileIdentity 写入的标识中读到了漫画和章节
+	identified bool
+}
+
+const identityPrefix = "copymanga:"
+
+// fileIdentity 生成写入文件元数据的标识, 记录文件属于哪部漫画和哪些章节
+func fileIdentity(pathWord string, comicUUID string, chapterUUIDs []string) string {
+	return fmt.Sprintf("%spath_word=%s;comic=%s;chapters=%s",
+		identityPrefix, pathWord, comicUUID, strings.Join(chapterUUIDs, ","))
+}
+
+// readIdentity 解析 fileIdentity 生成的标识, 不是该格式时返回 false
+func (s *scannedFile) readIdentity(value string) bool {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, identityPrefix) {
+		return false
+	}
+	s.chapterUUIDs = nil
+	for _, field := range strings.Split(strings.TrimPrefix(value, identityPrefix), ";") {
+		key, v, _ := strings.Cut(field, "=")
+		switch key {
+		case "path_word":
+			s.pathWord = v
+		case "comic":
+			s.comicUUID = v
+		case "chapters":
+			for _, uuid := range strings.Split(v, ",") {
+				if uuid != "" {
+					s.chapterUUIDs = append(s.chapterUUIDs, uuid)
+				}
+			}
+		}
+	}
+	s.identified = true
+	return true
+}
+
+var (
+	comicUrlPattern    = regexp.MustCompile(`/comic/([^/?#]+)(?:/chapter/([0-9a-fA-F-]{36}))?`)
+	uuidPattern        = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	pdfIdentityPattern = regexp.MustCompile(`/CopymangaIdentity \(([^)]*)\)`)
+	// 命名风格带来的序号前缀, 如 001-第1话
+	indexPrefixPattern = regexp.MustCompile(`^\d+-`)
+)
+
+// scan 遍历输出目录, 读取 CBZ 的 ComicInfo.xml 和 EPUB 的 OPF,
+// 将能匹配到漫画和章节的文件加入索引
+func (l *Library) scan() (ScanResult, error) {
+	result := ScanResult{Unmatched: []ScanIssue{}}
+
+	l.mu.Lock()
+	known := make(map[string]bool)
+	for _, comic := range l.comics {
+		for _, chapter := range comic.Chapters {
+			known[filepath.Clean(chapter.FilePath)] = true
+		}
+	}
+	l.mu.Unlock()
+
+	var files []*scannedFile
+	err := filepath.Walk(ConfigInstance.OutputPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == versionsDir {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || isTempFile(file) {
+			return nil
+		}
+		format := archiveFormat(file)
+		if format == "" {
+			return nil
+		}
+		if known[filepath.Clean(file)] {
+			result.Skipped++
+			return nil
+		}
+		scanned, err := readArchiveMeta(file, format)
+		if err != nil {
+			result.Unmatched = append(result.Unmatched, ScanIssue{file, err.Error()})
+			return nil
+		}
+		// 合并文件不能对应到单个章节, 不加入索引
+		if n := len(scanned.chapterUUIDs); n > 1 {
+			result.Unmatched = append(result.Unmatched, ScanIssue{file, fmt.Sprintf("bundle of %d chapters", n)})
+			return nil
+		}
+		files = append(files, scanned)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// 同一部漫画只请求一次章节列表
+	groups := make(map[string][]*scannedFile)
+	var keys []string
+	for _, file := range files {
+		key := file.pathWord
+		if key == "" {
+			key = "series:" + file.series
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], file)
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		downloader, err := resolveScannedComic(group[0])
+		if err != nil {
+			for _, file := range group {
+				result.Unmatched = append(result.Unmatched, ScanIssue{file.path, err.Error()})
+			}
+			continue
+		}
+		for _, file := range group {
+			chapter := matchScannedChapter(file, downloader.ChapterList)
+			if chapter == nil {
+				result.Unmatched = append(result.Unmatched, ScanIssue{file.path, "no matching chapter"})
+				continue
+			}
+			size, hash, err := fileDigest(file.path)
+			if err != nil {
+				result.Unmatched = append(result.Unmatched, ScanIssue{file.path, err.Error()})
+				continue
+			}
+			modTime := time.Now()
+			if info, err := os.Stat(file.path); err == nil {
+				modTime = info.ModTime()
+			}
+			l.mu.Lock()
+			l.recordChapter(downloader.bookInfo.UUID, downloader.pathWord, downloader.bookInfo.Series, &LibraryChapter{
+				UUID:         chapter.UUID,
+				Name:         chapter.Name,
+				Index:        chapter.Index,
+				Group:        downloader.group,
+				Format:       file.format,
+				FilePath:     file.path,
+				PageCount:    file.pageCount,
+				Size:         size,
+				Hash:         hash,
+				DownloadedAt: modTime,
+				RemoteSize:   chapter.Size,
+			})
+			l.mu.Unlock()
+			result.Added++
+		}
+	}
+
+	l.mu.Lock()
+	l.save()
+	l.mu.Unlock()
+	return result, nil
+}
+
+// resolveScannedComic 根据 path word 或系列名找到对应的漫画并获取章节列表
+func resolveScannedComic(file *scannedFile) (*Downloader, error) {
+	pathWord := file.pathWord
+	if pathWord == "" {
+		if file.series == "" {
+			return nil, fmt.Errorf("no series name")
+		}
+		comics, err := Search(ConfigInstance.UrlBase, file.series, 1)
+		if err != nil {
+			return nil, err
+		}
+		for _, comic := range comics {
+			if comic.Name == file.series || (file.comicUUID != "" && comic.UUID == file.comicUUID) {
+				pathWord = comic.PathWord
+				break
+			}
+		}
+		if pathWord == "" {
+			return nil, fmt.Errorf("no comic named %q", file.series)
+		}
+	}
+
+	downloader := NewDownloader(ConfigInstance.UrlBase, pathWord, ConfigInstance)
+	if err := downloader.GetComicInfo(); err != nil {
+		return nil, err
+	}
+	return downloader, nil
+}
+
+// matchScannedChapter 优先按章节 UUID 匹配.
+// 带有标识的文件只按 UUID 匹配, 其他文件再按标题匹配
+func matchScannedChapter(file *scannedFile, chapters []*ChapterInfo) *ChapterInfo {
+	if len(file.chapterUUIDs) == 1 {
+		for _, chapter := range chapters {
+			if chapter.UUID == file.chapterUUIDs[0] {
+				return chapter
+			}
+		}
+	}
+	if file.identified {
+		return nil
+	}
+	title := strings.TrimSpace(file.title)
+	for _, chapter := range chapters {
+		if chapter.Name == title || sanitizeFilename(chapter.Name) == title {
+			return chapter
+		}
+	}
+	return nil
+}
+
+func archiveFormat(file string) string {
+	if strings.HasSuffix(strings.ToLower(file), ".kepub.epub") {
+		return "kepub"
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".cbz":
+		return "cbz"
+	case ".cbt":
+		return "cbt"
+	case ".zip":
+		return "zip"
+	case ".epub":
+		return "epub"
+	case ".pdf":
+		return "pdf"
+	case ".mobi":
+		return "mobi"
+	case ".azw3":
+		return "azw3"
+	}
+	return ""
+}
+
+// readArchiveMeta 读取压缩包内的元数据, 缺失的字段用目录名和文件名补全
+func readArchiveMeta(file string, format string) (*scannedFile, error) {
+	switch format {
+	case "pdf":
+		return readPdfMeta(file)
+	case "cbt":
+		return readTarMeta(file)
+	case "mobi", "azw3":
+		return readMobiMeta(file, format)
+	}
+	reader, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	scanned := &scannedFile{path: file, format: format}
+	for _, f := range reader.File {
+		if isImageName(f.Name) {
+			scanned.pageCount++
+		}
+	}
+
+	switch format {
+	case "cbz", "zip":
+		if f := findZipFile(&reader.Reader, "ComicInfo.xml"); f != nil {
+			content, err := readZipEntry(f)
+			if err != nil {
+				return nil, err
+			}
+			if err := readComicInfoMeta(content, scanned); err != nil {
+				return nil, fmt.Errorf("invalid ComicInfo.xml: %v", err)
+			}
+		}
+	case "epub", "kepub":
+		if err := readOpfMeta(&reader.Reader, scanned); err != nil {
+			return nil, fmt.Errorf("invalid epub metadata: %v", err)
+		}
+	}
+
+	fillScannedNames(scanned)
+	return scanned, nil
+}
+
+// fillScannedNames 用目录名和文件名补全缺失的系列和标题
+func fillScannedNames(scanned *scannedFile) {
+	if scanned.series == "" {
+		scanned.series = filepath.Base(filepath.Dir(scanned.path))
+	}
+	if scanned.title == "" {
+		name := trimPackageExt(filepath.Base(scanned.path))
+		scanned.title = indexPrefixPattern.ReplaceAllString(name, "")
+	}
+}
+
+// readPdfMeta 从 PDF 中读取页数和文档信息中的标识, 系列和标题取自目录名和文件名
+func readPdfMeta(file string) (*scannedFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	scanned := &scannedFile{path: file, format: "pdf", pageCount: pdfPageCount(data)}
+	if match := pdfIdentityPattern.FindSubmatch(data); match != nil {
+		scanned.readIdentity(string(match[1]))
+	}
+	fillScannedNames(scanned)
+	return scanned, nil
+}
+
+func readTarMeta(file string) (*scannedFile, error) {
+	entries, err := readTarEntries(file)
+	if err != nil {
+		return nil, err
+	}
+	scanned := &scannedFile{path: file, format: "cbt"}
+	for _, entry := range entries {
+		if isImageName(entry.Name) {
+			scanned.pageCount++
+		} else if entry.Name == "ComicInfo.xml" {
+			if err := readComicInfoMeta(entry.Data, scanned); err != nil {
+				return nil, fmt.Errorf("invalid ComicInfo.xml: %v", err)
+			}
+		}
+	}
+	fillScannedNames(scanned)
+	return scanned, nil
+}
+
+func readComicInfoMeta(content []byte, scanned *scannedFile) error {
+	var info struct {
+		Series    string `xml:"Series"`
+		Title     string `xml:"Title"`
+		PageCount string `xml:"PageCount"`
+		Web       string `xml:"Web"`
+		Notes     string `xml:"Notes"`
+	}
+	if err := xml.Unmarshal(content, &info); err != nil {
+		return err
+	}
+	scanned.series = info.Series
+	scanned.title = info.Title
+	if count, err := strconv.Atoi(info.PageCount); err == nil && count > 0 {
+		scanned.pageCount = count
+	}
+	if scanned.readIdentity(info.Notes) {
+		return nil
+	}
+	// 旧版本写入的 ComicInfo 没有标识, 章节 UUID 在网址或备注中
+	if match := comicUrlPattern.FindStringSubmatch(info.Web); match != nil {
+		scanned.pathWord = match[1]
+		if match[2] != "" {
+			scanned.chapterUUIDs = []string{match[2]}
+		}
+	}
+	if len(scanned.chapterUUIDs) == 0 {
+		scanned.chapterUUIDs = uuidPattern.FindAllString(info.Notes, -1)
+	}
+	return nil
+}
+
+// opfPackage 只解析扫描和校验需要的 OPF 字段
+type opfPackage struct {
+	UniqueIdentifier string `xml:"unique-identifier,attr"`
+	Metadata         struct {
+		Title      []string `xml:"title"`
+		Identifier []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"identifier"`
+		Source []string `xml:"source"`
+		Meta   []struct {
+			Name     string `xml:"name,attr"`
+			Content  string `xml:"content,attr"`
+			Property string `xml:"property,attr"`
+			Value    string `xml:",chardata"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest struct {
+		Items []struct {
+			ID         string `xml:"id,attr"`
+			Href       string `xml:"href,attr"`
+			MediaType  string `xml:"media-type,attr"`
+			Properties string `xml:"properties,attr"`
+		} `xml:"item"`
+	} `xml:"manifest"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		ItemRefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+// isSeparateCover 判断第 i 项是否为不算作页面的封面图片.
+// 有单独的封面页时 cover-image 只是封面; 没有时 cover-image 标记的是第一页
+func (o *opfPackage) isSeparateCover(i int) bool {
+	if !strings.Contains(o.Manifest.Items[i].Properties, "cover-image") {
+		return false
+	}
+	for _, item := range o.Manifest.Items {
+		if item.MediaType == "application/xhtml+xml" && strings.Contains(strings.ToLower(path.Base(item.Href)), "cover") {
+			return true
+		}
+	}
+	return false
+}
+
+// readOpf 通过 container.xml 找到并解析 OPF, 返回 OPF 在压缩包内的路径
+func readOpf(reader *zip.Reader) (*opfPackage, string, error) {
+	containerFile := findZipFile(reader, "META-INF/container.xml")
+	if containerFile == nil {
+		return nil, "", fmt.Errorf("missing META-INF/container.xml")
+	}
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := readZipXml(containerFile, &container); err != nil {
+		return nil, "", err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, "", fmt.Errorf("container.xml has no rootfile")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	opfFile := findZipFile(reader, opfPath)
+	if opfFile == nil {
+		return nil, "", fmt.Errorf("missing %s", opfPath)
+	}
+	var opf opfPackage
+	if err := readZipXml(opfFile, &opf); err != nil {
+		return nil, "", err
+	}
+	return &opf, opfPath, nil
+}
+
+func readOpfMeta(reader *zip.Reader, scanned *scannedFile) error {
+	opf, _, err := readOpf(reader)
+	if err != nil {
+		return err
+	}
+	if len(opf.Metadata.Title) > 0 {
+		scanned.title = opf.Metadata.Title[0]
+	}
+	for _, meta := range opf.Metadata.Meta {
+		if meta.Name == "calibre:series" {
+			scanned.series = meta.Content
+		} else if meta.Property == "belongs-to-collection" && scanned.series == "" {
+			scanned.series = strings.TrimSpace(meta.Value)
+		} else if meta.Name == epubIdentityMeta {
+			scanned.readIdentity(meta.Content)
+		}
+	}
+	if !scanned.identified {
+		for _, source := range opf.Metadata.Source {
+			if match := comicUrlPattern.FindStringSubmatch(source); match != nil {
+				scanned.pathWord = match[1]
+				if match[2] != "" {
+					scanned.chapterUUIDs = []string{match[2]}
+				}
+			}
+		}
+	}
+
+	// 页数以 OPF 中声明的图片为准
+	pageCount := 0
+	for i, item := range opf.Manifest.Items {
+		if strings.HasPrefix(item.MediaType, "image/") && !opf.isSeparateCover(i) {
+			pageCount++
+		}
+	}
+	if pageCount > 0 {
+		scanned.pageCount = pageCount
+	}
+	return nil
+}
+
+func findZipFile(reader *zip.Reader, name string) *zip.File {
+	for _, f := range reader.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func readZipXml(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(content, v)
+}
+
+func isImageName(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".avif":
+		return true
+	}
+	return false
+}
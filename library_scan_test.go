@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadComicInfoMeta(t *testing.T) {
+	const comic = "5a2b3c4d-0000-11ee-8000-0242ac120002"
+	const first = "6e7f8a9b-0000-11ee-8000-0242ac120002"
+	const second = "7f8a9bac-0000-11ee-8000-0242ac120002"
+	tests := []struct {
+		name       string
+		xml        string
+		pathWord   string
+		comicUUID  string
+		chapters   []string
+		identified bool
+	}{
+		{
+			"identity",
+			`<ComicInfo><Notes>copymanga:path_word=demo;comic=` + comic + `;chapters=` + first + `</Notes>` +
+				`<Web>https://copymanga.tv/comic/demo</Web></ComicInfo>`,
+			"demo", comic, []string{first}, true,
+		},
+		{
+			"bundle identity",
+			`<ComicInfo><Notes>copymanga:path_word=demo;comic=` + comic + `;chapters=` + first + `,` + second + `</Notes></ComicInfo>`,
+			"demo", comic, []string{first, second}, true,
+		},
+		{
+			"legacy chapter url",
+			`<ComicInfo><Web>https://copymanga.tv/comic/demo/chapter/` + first + `</Web></ComicInfo>`,
+			"demo", "", []string{first}, false,
+		},
+		{
+			"legacy bundle notes",
+			`<ComicInfo><Notes>` + first + `, ` + second + `</Notes><Web>https://copymanga.tv/comic/demo</Web></ComicInfo>`,
+			"demo", "", []string{first, second}, false,
+		},
+		{"third party", `<ComicInfo><Notes>scanned by someone</Notes></ComicInfo>`, "", "", nil, false},
+	}
+	for _, tt := range tests {
+		scanned := &scannedFile{}
+		if err := readComicInfoMeta([]byte(tt.xml), scanned); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if scanned.pathWord != tt.pathWord || scanned.comicUUID != tt.comicUUID ||
+			!reflect.DeepEqual(scanned.chapterUUIDs, tt.chapters) || scanned.identified != tt.identified {
+			t.Errorf("%s: got %q %q %q %v", tt.name, scanned.pathWord, scanned.comicUUID, scanned.chapterUUIDs, scanned.identified)
+		}
+	}
+}
+
+func TestMatchScannedChapter(t *testing.T) {
+	chapters := []*ChapterInfo{{UUID: "a", Name: "第1话"}, {UUID: "b", Name: "第2话"}}
+	tests := []struct {
+		name string
+		file scannedFile
+		want string
+	}{
+		{"by uuid", scannedFile{chapterUUIDs: []string{"b"}, title: "第1话"}, "b"},
+		{"by title", scannedFile{title: "第1话"}, "a"},
+		// 带标识的文件不退回到标题匹配
+		{"identified unknown uuid", scannedFile{chapterUUIDs: []string{"c"}, title: "第1话", identified: true}, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if chapter := matchScannedChapter(&tt.file, chapters); chapter != nil {
+			got = chapter.UUID
+		}
+		if got != tt.want {
+			t.Errorf("%s: matched %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPageVariants(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages []PageInfo
+		want  []string
+	}{
+		{"no variants", []PageInfo{{Name: "001.jpg"}, {Name: "002.jpg"}}, nil},
+		{"downgraded page", []PageInfo{{Variant: "c1500x"}, {Variant: "c800x"}}, []string{"c1500x", "c800x"}},
+		{"partly known", []PageInfo{{Variant: "c1500x"}, {}}, []string{"c1500x", ""}},
+		{"empty chapter", nil, nil},
+	}
+	for _, tt := range tests {
+		if got := pageVariants(tt.pages); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: pageVariants = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUpstreamChanged(t *testing.T) {
+	fingerprints := pageFingerprints([]string{
+		"https://hi77-overseas.mangafuna.xyz/demo/a/001.jpg.c800x.jpg",
+		"https://hi77-overseas.mangafuna.xyz/demo/a/002.jpg.c800x.jpg",
+	})
+	// 换了 CDN 和分辨率, 图片本身没有变化
+	same := pageFingerprints([]string{
+		"https://hi88-overseas.mangafuna.xyz/demo/a/001.jpg.c1500x.webp",
+		"https://hi88-overseas.mangafuna.xyz/demo/a/002.jpg",
+	})
+	replaced := pageFingerprints([]string{
+		"https://hi77-overseas.mangafuna.xyz/demo/a/001.jpg.c800x.jpg",
+		"https://hi77-overseas.mangafuna.xyz/demo/b/002.jpg.c800x.jpg",
+	})
+	tests := []struct {
+		name    string
+		local   LibraryChapter
+		remote  ChapterInfo
+		current []string
+		want    bool
+	}{
+		{"same size", LibraryChapter{RemoteSize: 2}, ChapterInfo{Size: 2}, nil, false},
+		{"size changed", LibraryChapter{RemoteSize: 2}, ChapterInfo{Size: 3}, nil, true},
+		{"size unknown", LibraryChapter{}, ChapterInfo{Size: 3}, nil, false},
+		{"same pages", LibraryChapter{RemoteSize: 2, PageFingerprints: fingerprints}, ChapterInfo{Size: 2}, same, false},
+		{"page replaced", LibraryChapter{RemoteSize: 2, PageFingerprints: fingerprints}, ChapterInfo{Size: 2}, replaced, true},
+		{"pages not fetched", LibraryChapter{RemoteSize: 2, PageFingerprints: fingerprints}, ChapterInfo{Size: 2}, nil, false},
+		{"no recorded pages", LibraryChapter{RemoteSize: 2}, ChapterInfo{Size: 2}, replaced, false},
+	}
+	for _, tt := range tests {
+		if got := upstreamChanged(&tt.local, &tt.remote, tt.current); got != tt.want {
+			t.Errorf("%s: upstreamChanged = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VerifyIssue 校验失败的章节
+type VerifyIssue struct {
+	ComicUUID   string `json:"comicUUID"`
+	PathWord    string `json:"pathWord"`
+	Series      string `json:"series"`
+	ChapterUUID string `json:"chapterUUID"`
+	Name        string `json:"name"`
+	Group       string `json:"group"`
+	Format      string `json:"format"`
+	FilePath    string `json:"filePath"`
+	Bundle      string `json:"bundle"`
+	Problem     string `json:"problem"`
+}
+
+type VerifyResult struct {
+	Checked int           `json:"checked"`
+	Broken  []VerifyIssue `json:"broken"`
+	// 文件完好但结构不符合规范, 只提示, 不会重新下载
+	Warnings []VerifyIssue `json:"warnings"`
+	Requeued int           `json:"requeued"`
+	// 损坏但在合并文件中, 不能单独重新下载的章节
+	Bundled []VerifyIssue `json:"bundled"`
+}
+
+// verify 逐个打开索引中的文件, 检查压缩包 CRC, 解析图片头并核对页数,
+// 损坏的章节会在索引中标记. 完好的文件再用 validatePackage 检查结构, 结果作为警告返回
+func (l *Library) verify() VerifyResult {
+	type entry struct {
+		comic   *LibraryComic
+		chapter LibraryChapter
+	}
+	l.mu.Lock()
+	var entries []entry
+	for _, comic := range l.comics {
+		for _, chapter := range comic.Chapters {
+			entries = append(entries, entry{comic, *chapter})
+		}
+	}
+	l.mu.Unlock()
+
+	result := VerifyResult{Broken: []VerifyIssue{}, Warnings: []VerifyIssue{}, Bundled: []VerifyIssue{}}
+	problems := make(map[string]string, len(entries))
+	// 合并文件中的章节共用一个文件, 结构只检查一次
+	warnings := make(map[string]error)
+	for _, e := range entries {
+		result.Checked++
+		issue := VerifyIssue{
+			ComicUUID:   e.comic.UUID,
+			PathWord:    e.comic.PathWord,
+			Series:      e.comic.Series,
+			ChapterUUID: e.chapter.UUID,
+			Name:        e.chapter.Name,
+			Group:       e.chapter.Group,
+			Format:      e.chapter.Format,
+			FilePath:    e.chapter.FilePath,
+			Bundle:      e.chapter.Bundle,
+		}
+		if err := verifyChapterFile(e.chapter.FilePath, e.chapter.Format, e.chapter.PageCount); err != nil {
+			problems[e.chapter.UUID] = err.Error()
+			issue.Problem = err.Error()
+			result.Broken = append(result.Broken, issue)
+			continue
+		}
+		problems[e.chapter.UUID] = ""
+		warning, ok := warnings[e.chapter.FilePath]
+		if !ok {
+			warning = validatePackage(e.chapter.FilePath, e.chapter.Format)
+			warnings[e.chapter.FilePath] = warning
+		}
+		if warning != nil {
+			issue.Problem = warning.Error()
+			result.Warnings = append(result.Warnings, issue)
+		}
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	for _, e := range entries {
+		if chapter, ok := e.comic.Chapters[e.chapter.UUID]; ok {
+			chapter.Problem = problems[e.chapter.UUID]
+			chapter.VerifiedAt = now
+		}
+	}
+	l.save()
+	l.mu.Unlock()
+	return result
+}
+
+// verifyChapterFile 检查单个章节文件是否损坏, pageCount 为索引中记录的页数, 0 表示不核对.
+// 不检查结构是否符合规范
+func verifyChapterFile(filePath string, format string, pageCount int) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("missing file: %v", err)
+	}
+	if info.IsDir() {
+		return verifyImageDir(filePath, pageCount)
+	}
+	switch format {
+	case "pdf":
+		return verifyPdf(filePath, pageCount)
+	case "cbt":
+		return verifyTar(filePath, pageCount)
+	case "mobi", "azw3":
+		return verifyMobi(filePath, pageCount)
+	}
+
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return fmt.Errorf("invalid archive: %v", err)
+	}
+	defer reader.Close()
+
+	images := make(map[string]bool)
+	for _, f := range reader.File {
+		data, err := readZipEntry(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+		if !isImageName(f.Name) {
+			continue
+		}
+		if _, err := checkImage(bytes.NewReader(data), int64(len(data)), ImageCheckHeader); err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+		images[f.Name] = true
+	}
+
+	pages := len(images)
+	switch format {
+	case "cbz":
+		if f := findZipFile(&reader.Reader, "ComicInfo.xml"); f != nil {
+			content, err := readZipEntry(f)
+			if err != nil {
+				return err
+			}
+			if err := checkComicInfoPages(content, pages); err != nil {
+				return err
+			}
+		}
+	case "epub", "kepub":
+		opf, opfPath, err := readOpf(&reader.Reader)
+		if err != nil {
+			return fmt.Errorf("invalid epub metadata: %v", err)
+		}
+		pages = 0
+		for i, item := range opf.Manifest.Items {
+			if !strings.HasPrefix(item.MediaType, "image/") {
+				continue
+			}
+			name := path.Join(path.Dir(opfPath), item.Href)
+			if !images[name] {
+				return fmt.Errorf("manifest item %s is missing from archive", item.Href)
+			}
+			if !opf.isSeparateCover(i) {
+				pages++
+			}
+		}
+	}
+
+	if pageCount > 0 && pages != pageCount {
+		return fmt.Errorf("page count mismatch: expected %d, found %d", pageCount, pages)
+	}
+	return nil
+}
+
+// checkComicInfoPages 核对 ComicInfo 中的页数与压缩包中的图片数
+func checkComicInfoPages(content []byte, pages int) error {
+	var comicInfo struct {
+		PageCount string `xml:"PageCount"`
+	}
+	if err := xml.Unmarshal(content, &comicInfo); err != nil {
+		return fmt.Errorf("invalid ComicInfo.xml: %v", err)
+	}
+	if expected, err := strconv.Atoi(comicInfo.PageCount); err == nil && expected != pages {
+		return fmt.Errorf("page count mismatch: ComicInfo has %d, archive has %d", expected, pages)
+	}
+	return nil
+}
+
+func verifyTar(filePath string, pageCount int) error {
+	entries, err := readTarEntries(filePath)
+	if err != nil {
+		return fmt.Errorf("invalid archive: %v", err)
+	}
+	pages := 0
+	for _, entry := range entries {
+		if !isImageName(entry.Name) {
+			continue
+		}
+		if _, err := checkImage(bytes.NewReader(entry.Data), int64(len(entry.Data)), ImageCheckHeader); err != nil {
+			return fmt.Errorf("%s: %v", entry.Name, err)
+		}
+		pages++
+	}
+	for _, entry := range entries {
+		if entry.Name == "ComicInfo.xml" {
+			if err := checkComicInfoPages(entry.Data, pages); err != nil {
+				return err
+			}
+		}
+	}
+	if pageCount > 0 && pages != pageCount {
+		return fmt.Errorf("page count mismatch: expected %d, found %d", pageCount, pages)
+	}
+	return nil
+}
+
+func verifyImageDir(dir string, pageCount int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	pages := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !isImageName(entry.Name()) {
+			continue
+		}
+		if _, err := validateImageFile(filepath.Join(dir, entry.Name()), ImageCheckHeader); err != nil {
+			return fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+		pages++
+	}
+	if pageCount > 0 && pages != pageCount {
+		return fmt.Errorf("page count mismatch: expected %d, found %d", pageCount, pages)
+	}
+	return nil
+}
+
+// verifyPdf 检查文件头和结尾标记并核对页数, 不校验嵌入的图片
+func verifyPdf(filePath string, pageCount int) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return fmt.Errorf("invalid pdf header")
+	}
+	if !bytes.Contains(data[max(len(data)-1024, 0):], []byte("%%EOF")) {
+		return fmt.Errorf("truncated pdf")
+	}
+	if pages := pdfPageCount(data); pageCount > 0 && pages != pageCount {
+		return fmt.Errorf("page count mismatch: expected %d, found %d", pageCount, pages)
+	}
+	return nil
+}
+
+// readZipEntry 读取整个条目, 读到结尾时 zip 包会校验 CRC
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -1,19 +1,24 @@
+//go:build !headless
+
 package main
 
 import (
-	"embed"
+	"context"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
 )
 
-//go:embed all:frontend/dist
-var assets embed.FS
-
 func main() {
+	if code, ok := runCli(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
 	// Create an instance of the app structure
 	downloaderManager := &DownloaderManager{downloaders: make([]*DownloaderSingle, 0, 200)}
+	subscriptionManager := NewSubscriptionManager("subscriptions.json", downloaderManager)
 
 	// Create application with options
 	err := wails.Run(&options.App{
@@ -24,10 +29,15 @@ func main() {
 			Assets: assets,
 		},
 		// BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
-		OnStartup: downloaderManager.startup,
+		OnStartup: func(ctx context.Context) {
+			downloaderManager.startup(ctx)
+			subscriptionManager.startup(ctx)
+		},
 		Bind: []interface{}{
 			ConfigInstance,
 			downloaderManager,
+			subscriptionManager,
+			LibraryInstance,
 		},
 	})
 
@@ -0,0 +1,19 @@
+//go:build headless
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// main 只有命令行和服务器模式, 不链接 Wails, 适合在没有图形界面的环境中运行.
+// 使用 go build -tags headless 编译
+func main() {
+	code, ok := runCli(os.Args[1:])
+	if !ok {
+		fmt.Fprintln(os.Stderr, cliUsage)
+		code = exitUsage
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,870 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 正文按 4096 字节分为多条记录
+	mobiRecordSize = 4096
+	mobiNull       = 0xFFFFFFFF
+	mobiIndxHeader = 192
+	// 单条索引记录的大小上限, 与 kindlegen 一样留出余量
+	mobiIndexLimit = 0x10000 - mobiIndxHeader - 1048
+	mobiCncxLimit  = 0x10000 - 1024
+	// MOBI 头的长度, 不含前面 16 字节的 PalmDOC 头
+	mobiHeaderLength = 264
+)
+
+var (
+	mobiFlis = []byte("FLIS\x00\x00\x00\x08\x00\x41\x00\x00\x00\x00\x00\x00\xff\xff\xff\xff\x00\x01\x00\x03\x00\x00\x00\x03\x00\x00\x00\x01\xff\xff\xff\xff")
+	mobiEof  = []byte("\xe9\x8e\r\n")
+)
+
+// MobiBuilder 把图片目录打包为 KF8 格式的 MOBI/AZW3, 使用 Kindle 的固定版式漫画设置.
+// JPEG, PNG 和 GIF 直接嵌入, 其余格式解码后重新编码为 JPEG
+type MobiBuilder struct {
+	Title       string
+	Author      string
+	Description string
+	Subject     []string
+	// 写入 ASIN 字段, 扫描书库时用于匹配漫画
+	Identifier string
+	// 章节网址
+	Source string
+	// fileIdentity 生成的标识, 作为第二条来源写入
+	Identity string
+	// 从右向左翻页, 用于日漫
+	Rtl bool
+	// 封面图片, 为空时以第一页作为封面
+	Cover    []byte
+	chapters []mobiChapter
+}
+
+type mobiChapter struct {
+	title string
+	pages []string
+}
+
+// mobiImage 嵌入的图片资源
+type mobiImage struct {
+	data      []byte
+	mediaType string
+	width     int
+	height    int
+}
+
+// mobiPart KF8 正文中的一页. 每页是一个骨架文件, 图片作为唯一的片段插入 body 中
+type mobiPart struct {
+	skelStart  int
+	skelLength int
+	insertPos  int
+	selector   string
+	fragLength int
+}
+
+// AddChapter 添加一个章节的图片目录, 有标题的章节会加入目录
+func (mb *MobiBuilder) AddChapter(title string, imgPath string) error {
+	pages, err := listPageFiles(imgPath)
+	if err != nil {
+		return err
+	}
+	mb.chapters = append(mb.chapters, mobiChapter{title: title, pages: pages})
+	return nil
+}
+
+func (mb *MobiBuilder) Build(path string) error {
+	data, err := mb.build()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	return atomicWriteFile(path, func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+}
+
+func (mb *MobiBuilder) build() ([]byte, error) {
+	var resources []mobiImage
+	if mb.Cover != nil {
+		cover, err := newMobiImage(mb.Cover)
+		if err != nil {
+			return nil, fmt.Errorf("cover: %v", err)
+		}
+		resources = append(resources, cover)
+	}
+
+	var text bytes.Buffer
+	var parts []mobiPart
+	var tocTitles []string
+	var tocParts []int
+	var width, height int
+	for _, chapter := range mb.chapters {
+		for j, page := range chapter.pages {
+			data, err := os.ReadFile(page)
+			if err != nil {
+				return nil, err
+			}
+			img, err := newMobiImage(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", filepath.Base(page), err)
+			}
+			resources = append(resources, img)
+			if j == 0 && chapter.title != "" {
+				tocTitles = append(tocTitles, chapter.title)
+				tocParts = append(tocParts, len(parts))
+			}
+			width, height = max(width, img.width), max(height, img.height)
+			parts = append(parts, writeMobiPage(&text, len(parts), img, len(resources)))
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no pages to write")
+	}
+	// 目录不能为空, 没有章节标题时以书名指向第一页
+	if len(tocTitles) == 0 {
+		tocTitles, tocParts = []string{mb.Title}, []int{0}
+	}
+
+	records := [][]byte{nil}
+	textRecords := mobiTextRecords(text.Bytes())
+	records = append(records, textRecords...)
+	firstNonText := len(records)
+	chunkIndex := len(records)
+	records = append(records, mobiChunkIndex(parts)...)
+	skelIndex := len(records)
+	records = append(records, mobiSkelIndex(parts)...)
+	ncxIndex := len(records)
+	records = append(records, mobiNcxIndex(parts, tocTitles, tocParts, text.Len())...)
+	firstResource := len(records)
+	for _, resource := range resources {
+		records = append(records, resource.data)
+	}
+	fdstRecord := len(records)
+	records = append(records, mobiFdst(text.Len()))
+	flisRecord := len(records)
+	records = append(records, mobiFlis)
+	fcisRecord := len(records)
+	records = append(records, mobiFcis(text.Len()))
+	records = append(records, mobiEof)
+
+	exth := &mobiExth{}
+	exth.addString(100, mb.Author)
+	exth.addString(103, mb.Description)
+	for _, subject := range mb.Subject {
+		exth.addString(105, subject)
+	}
+	exth.addString(112, mb.Source)
+	exth.addString(112, mb.Identity)
+	exth.addString(113, mb.Identifier)
+	exth.addString(504, mb.Identifier)
+	exth.addString(501, "EBOK")
+	exth.addString(503, mb.Title)
+	exth.addString(524, "zh")
+	// 固定版式漫画的设置, 与 kindlegen 处理漫画时写入的一致
+	exth.addString(122, "true")
+	exth.addString(123, "comic")
+	exth.addString(124, "none")
+	exth.addString(126, fmt.Sprintf("%dx%d", width, height))
+	exth.addString(132, "false")
+	if mb.Rtl {
+		exth.addString(525, "horizontal-rl")
+		exth.addString(527, "rtl")
+	} else {
+		exth.addString(525, "horizontal-lr")
+		exth.addString(527, "ltr")
+	}
+	exth.addInt(125, uint32(len(resources)))
+	// 封面是第一个资源, 可能是单独的封面图片或第一页
+	exth.addInt(201, 0)
+	exth.addInt(202, 0)
+	exth.addInt(203, 0)
+	exth.addString(129, "kindle:embed:"+mobiBase32(1, 4))
+	exthData := exth.bytes()
+
+	title := []byte(mb.Title)
+	header := make([]byte, 16+mobiHeaderLength)
+	be := binary.BigEndian
+	// PalmDOC 头, 正文不压缩
+	be.PutUint16(header[0:], 1)
+	be.PutUint32(header[4:], uint32(text.Len()))
+	be.PutUint16(header[8:], uint16(len(textRecords)))
+	be.PutUint16(header[10:], mobiRecordSize)
+	copy(header[16:], "MOBI")
+	be.PutUint32(header[20:], mobiHeaderLength)
+	be.PutUint32(header[24:], 2)
+	be.PutUint32(header[28:], 65001)
+	be.PutUint32(header[32:], crc32.ChecksumIEEE([]byte(mb.Identifier+mb.Title)))
+	be.PutUint32(header[36:], 8)
+	for offset := 40; offset < 80; offset += 4 {
+		be.PutUint32(header[offset:], mobiNull)
+	}
+	be.PutUint32(header[80:], uint32(firstNonText))
+	be.PutUint32(header[84:], uint32(len(header)+len(exthData)))
+	be.PutUint32(header[88:], uint32(len(title)))
+	// 简体中文
+	be.PutUint32(header[92:], 0x0804)
+	be.PutUint32(header[104:], 8)
+	be.PutUint32(header[108:], uint32(firstResource))
+	be.PutUint32(header[128:], 0x50)
+	be.PutUint32(header[164:], mobiNull)
+	be.PutUint32(header[168:], mobiNull)
+	be.PutUint32(header[192:], uint32(fdstRecord))
+	be.PutUint32(header[196:], 1)
+	be.PutUint32(header[200:], uint32(fcisRecord))
+	be.PutUint32(header[204:], 1)
+	be.PutUint32(header[208:], uint32(flisRecord))
+	be.PutUint32(header[212:], 1)
+	be.PutUint32(header[224:], mobiNull)
+	be.PutUint64(header[232:], 0xFFFFFFFFFFFFFFFF)
+	// 正文记录末尾带有截断的多字节字符
+	be.PutUint32(header[240:], 1)
+	be.PutUint32(header[244:], uint32(ncxIndex))
+	be.PutUint32(header[248:], uint32(chunkIndex))
+	be.PutUint32(header[252:], uint32(skelIndex))
+	be.PutUint32(header[256:], mobiNull)
+	be.PutUint32(header[260:], mobiNull)
+	be.PutUint32(header[264:], mobiNull)
+	be.PutUint32(header[272:], mobiNull)
+	record0 := append(header, exthData...)
+	record0 = append(record0, title...)
+	record0 = mobiAlign(append(record0, 0, 0))
+	records[0] = record0
+
+	return mobiPdb(mb.Title, records), nil
+}
+
+// writeMobiPage 写入一页的骨架和片段, 片段插入在 body 开始标签之后
+func writeMobiPage(text *bytes.Buffer, i int, img mobiImage, resource int) mobiPart {
+	aid := mobiBase32(i, 1)
+	part := mobiPart{skelStart: text.Len(), selector: fmt.Sprintf("P-//*[@aid='%s']", aid)}
+	fmt.Fprintf(text, `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>%03d</title><meta name="viewport" content="width=%d, height=%d"/>`+
+		`<style type="text/css">html, body { margin: 0; padding: 0; } img { display: block; width: %dpx; height: %dpx; }</style>`+
+		`</head><body aid="%s">`, i+1, img.width, img.height, img.width, img.height, aid)
+	part.insertPos = text.Len()
+	text.WriteString("</body></html>")
+	part.skelLength = text.Len() - part.skelStart
+
+	start := text.Len()
+	fmt.Fprintf(text, `<img src="kindle:embed:%s?mime=%s" alt="" width="%d" height="%d"/>`,
+		mobiBase32(resource, 4), img.mediaType, img.width, img.height)
+	part.fragLength = text.Len() - start
+	return part
+}
+
+// newMobiImage Kindle 只支持 JPEG, PNG 和 GIF, 其他格式合成到白色背景上转为 JPEG
+func newMobiImage(data []byte) (mobiImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return mobiImage{}, err
+	}
+	switch format {
+	case "jpeg", "png", "gif":
+		return mobiImage{data: data, mediaType: "image/" + format, width: config.Width, height: config.Height}, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return mobiImage{}, err
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Over)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: 90}); err != nil {
+		return mobiImage{}, err
+	}
+	return mobiImage{data: buf.Bytes(), mediaType: "image/jpeg", width: bounds.Dx(), height: bounds.Dy()}, nil
+}
+
+// mobiTextRecords 把正文切分为记录, 记录末尾截断的多字节字符补全到本记录,
+// 最后一个字节记录补全的字节数
+func mobiTextRecords(text []byte) [][]byte {
+	var records [][]byte
+	for start := 0; start < len(text); start += mobiRecordSize {
+		end := min(start+mobiRecordSize, len(text))
+		overlap := 0
+		for end+overlap < len(text) && overlap < 3 && text[end+overlap]&0xC0 == 0x80 {
+			overlap++
+		}
+		record := append([]byte(nil), text[start:end+overlap]...)
+		records = append(records, append(record, byte(overlap)))
+	}
+	return records
+}
+
+func mobiSkelIndex(parts []mobiPart) [][]byte {
+	tags := []mobiTag{{1, 1, 3}, {6, 2, 12}}
+	entries := make([]mobiIndexEntry, len(parts))
+	for i, part := range parts {
+		start, length := uint32(part.skelStart), uint32(part.skelLength)
+		// kindlegen 生成的骨架索引中每个值都重复一次
+		entries[i] = mobiIndexEntry{
+			name:   fmt.Sprintf("SKEL%010d", i),
+			values: [][]uint32{{1, 1}, {start, length, start, length}},
+		}
+	}
+	return buildMobiIndex(tags, entries, nil)
+}
+
+func mobiChunkIndex(parts []mobiPart) [][]byte {
+	selectors := make([]string, len(parts))
+	for i, part := range parts {
+		selectors[i] = part.selector
+	}
+	cncx, offsets := buildMobiCncx(selectors)
+
+	tags := []mobiTag{{2, 1, 1}, {3, 1, 2}, {4, 1, 4}, {6, 2, 8}}
+	entries := make([]mobiIndexEntry, len(parts))
+	for i, part := range parts {
+		entries[i] = mobiIndexEntry{
+			name:   fmt.Sprintf("%010d", part.insertPos),
+			values: [][]uint32{{offsets[part.selector]}, {uint32(i)}, {uint32(i)}, {0, uint32(part.fragLength)}},
+		}
+	}
+	return buildMobiIndex(tags, entries, cncx)
+}
+
+// mobiNcxIndex 目录索引, 每项指向章节第一页的片段
+func mobiNcxIndex(parts []mobiPart, titles []string, targets []int, textLength int) [][]byte {
+	cncx, offsets := buildMobiCncx(titles)
+
+	tags := []mobiTag{{1, 1, 1}, {2, 1, 2}, {3, 1, 4}, {4, 1, 8}, {21, 1, 16}, {22, 1, 32}, {23, 1, 64}, {6, 2, 128}}
+	format := fmt.Sprintf("%%0%dX", max(2, len(fmt.Sprintf("%X", len(titles)-1))))
+	entries := make([]mobiIndexEntry, len(titles))
+	for i, title := range titles {
+		pos := parts[targets[i]].insertPos
+		end := textLength
+		if i+1 < len(targets) {
+			end = parts[targets[i+1]].insertPos
+		}
+		entries[i] = mobiIndexEntry{
+			name:   fmt.Sprintf(format, i),
+			values: [][]uint32{{uint32(pos)}, {uint32(end - pos)}, {offsets[title]}, {0}, nil, nil, nil, {uint32(targets[i]), 0}},
+		}
+	}
+	return buildMobiIndex(tags, entries, cncx)
+}
+
+// mobiTag 索引条目中的一个标签, 对应 TAGX 表中的一行
+type mobiTag struct {
+	number         byte
+	valuesPerEntry byte
+	mask           byte
+}
+
+// mobiIndexEntry 索引条目, values 与标签按顺序对应, 为空表示没有该标签
+type mobiIndexEntry struct {
+	name   string
+	values [][]uint32
+}
+
+// buildMobiIndex 生成索引头记录, 索引记录以及 CNCX 字符串记录
+func buildMobiIndex(tags []mobiTag, entries []mobiIndexEntry, cncx [][]byte) [][]byte {
+	be := binary.BigEndian
+	type block struct {
+		data    bytes.Buffer
+		offsets []int
+		last    string
+	}
+	blocks := []*block{{}}
+	for _, entry := range entries {
+		var raw bytes.Buffer
+		raw.WriteByte(byte(len(entry.name)))
+		raw.WriteString(entry.name)
+		control := byte(0)
+		for i, tag := range tags {
+			count := len(entry.values[i]) / int(tag.valuesPerEntry)
+			control |= tag.mask & byte(count<<bits.TrailingZeros8(tag.mask))
+		}
+		raw.WriteByte(control)
+		for _, values := range entry.values {
+			for _, value := range values {
+				raw.Write(mobiEncint(value))
+			}
+		}
+
+		b := blocks[len(blocks)-1]
+		if b.data.Len()+2*len(b.offsets)+raw.Len()+2 > mobiIndexLimit {
+			b = &block{}
+			blocks = append(blocks, b)
+		}
+		b.offsets = append(b.offsets, mobiIndxHeader+b.data.Len())
+		b.data.Write(raw.Bytes())
+		b.last = entry.name
+	}
+
+	records := [][]byte{nil}
+	var geometry bytes.Buffer
+	var geometryOffsets []int
+	tagx := mobiTagx(tags)
+	for _, b := range blocks {
+		data := mobiAlign(b.data.Bytes())
+		header := make([]byte, mobiIndxHeader)
+		copy(header, "INDX")
+		be.PutUint32(header[4:], mobiIndxHeader)
+		be.PutUint32(header[12:], 1)
+		be.PutUint32(header[20:], uint32(mobiIndxHeader+len(data)))
+		be.PutUint32(header[24:], uint32(len(b.offsets)))
+		be.PutUint64(header[28:], 0xFFFFFFFFFFFFFFFF)
+		records = append(records, append(append(header, data...), mobiIdxt(b.offsets)...))
+
+		geometryOffsets = append(geometryOffsets, mobiIndxHeader+len(tagx)+geometry.Len())
+		geometry.WriteByte(byte(len(b.last)))
+		geometry.WriteString(b.last)
+		binary.Write(&geometry, be, uint16(len(b.offsets)))
+	}
+
+	geometryData := mobiAlign(geometry.Bytes())
+	header := make([]byte, mobiIndxHeader)
+	copy(header, "INDX")
+	be.PutUint32(header[4:], mobiIndxHeader)
+	be.PutUint32(header[16:], 2)
+	be.PutUint32(header[20:], uint32(mobiIndxHeader+len(tagx)+len(geometryData)))
+	be.PutUint32(header[24:], uint32(len(blocks)))
+	be.PutUint32(header[28:], 65001)
+	be.PutUint32(header[32:], mobiNull)
+	be.PutUint32(header[36:], uint32(len(entries)))
+	be.PutUint32(header[52:], uint32(len(cncx)))
+	be.PutUint32(header[180:], mobiIndxHeader)
+	record := append(header, tagx...)
+	record = append(record, geometryData...)
+	records[0] = append(record, mobiIdxt(geometryOffsets)...)
+	return append(records, cncx...)
+}
+
+func mobiTagx(tags []mobiTag) []byte {
+	tagx := []byte("TAGX")
+	tagx = binary.BigEndian.AppendUint32(tagx, uint32(12+4*(len(tags)+1)))
+	// 控制字节数
+	tagx = binary.BigEndian.AppendUint32(tagx, 1)
+	for _, tag := range tags {
+		tagx = append(tagx, tag.number, tag.valuesPerEntry, tag.mask, 0)
+	}
+	return append(tagx, 0, 0, 0, 1)
+}
+
+func mobiIdxt(offsets []int) []byte {
+	idxt := []byte("IDXT")
+	for _, offset := range offsets {
+		idxt = binary.BigEndian.AppendUint16(idxt, uint16(offset))
+	}
+	return mobiAlign(idxt)
+}
+
+// buildMobiCncx 把索引中的字符串写入 CNCX 记录, 返回记录和每个字符串的偏移量
+func buildMobiCncx(strs []string) ([][]byte, map[string]uint32) {
+	offsets := make(map[string]uint32)
+	var records [][]byte
+	var buf bytes.Buffer
+	for _, s := range strs {
+		if _, ok := offsets[s]; ok {
+			continue
+		}
+		raw := append(mobiEncint(uint32(len(s))), s...)
+		if buf.Len()+len(raw) > mobiCncxLimit {
+			records = append(records, mobiAlign(buf.Bytes()))
+			buf.Reset()
+		}
+		offsets[s] = uint32(len(records)*0x10000 + buf.Len())
+		buf.Write(raw)
+	}
+	if buf.Len() > 0 {
+		records = append(records, mobiAlign(buf.Bytes()))
+	}
+	return records, offsets
+}
+
+// mobiFdst 正文只有一个 flow, 样式都写在页面中
+func mobiFdst(textLength int) []byte {
+	fdst := []byte("FDST")
+	for _, value := range []uint32{12, 1, 0, uint32(textLength)} {
+		fdst = binary.BigEndian.AppendUint32(fdst, value)
+	}
+	return fdst
+}
+
+func mobiFcis(textLength int) []byte {
+	fcis := []byte("FCIS\x00\x00\x00\x14\x00\x00\x00\x10\x00\x00\x00\x02\x00\x00\x00\x00")
+	fcis = binary.BigEndian.AppendUint32(fcis, uint32(textLength))
+	fcis = append(fcis, "\x00\x00\x00\x00\x00\x00\x00\x28\x00\x00\x00\x00\x00\x00\x00"...)
+	return append(fcis, "\x28\x00\x00\x00\x08\x00\x01\x00\x01\x00\x00\x00\x00"...)
+}
+
+// mobiExth MOBI 头之后的 EXTH 元数据
+type mobiExth struct {
+	buf   bytes.Buffer
+	count int
+}
+
+func (e *mobiExth) add(id uint32, data []byte) {
+	binary.Write(&e.buf, binary.BigEndian, [2]uint32{id, uint32(8 + len(data))})
+	e.buf.Write(data)
+	e.count++
+}
+
+func (e *mobiExth) addString(id uint32, value string) {
+	if value != "" {
+		e.add(id, []byte(value))
+	}
+}
+
+func (e *mobiExth) addInt(id uint32, value uint32) {
+	e.add(id, binary.BigEndian.AppendUint32(nil, value))
+}
+
+func (e *mobiExth) bytes() []byte {
+	exth := []byte("EXTH")
+	exth = binary.BigEndian.AppendUint32(exth, uint32(12+e.buf.Len()))
+	exth = binary.BigEndian.AppendUint32(exth, uint32(e.count))
+	return mobiAlign(append(exth, e.buf.Bytes()...))
+}
+
+// mobiPdb 把记录写入 Palm 数据库容器
+func mobiPdb(title string, records [][]byte) []byte {
+	be := binary.BigEndian
+	header := make([]byte, 78)
+	copy(header, mobiPdbName(title))
+	now := uint32(time.Now().Unix())
+	be.PutUint32(header[36:], now)
+	be.PutUint32(header[40:], now)
+	copy(header[60:], "BOOKMOBI")
+	be.PutUint32(header[68:], uint32(2*len(records)-1))
+	be.PutUint16(header[76:], uint16(len(records)))
+
+	offset := len(header) + 8*len(records) + 2
+	data := header
+	for i, record := range records {
+		data = be.AppendUint32(data, uint32(offset))
+		data = be.AppendUint32(data, uint32(2*i))
+		offset += len(record)
+	}
+	data = append(data, 0, 0)
+	for _, record := range records {
+		data = append(data, record...)
+	}
+	return data
+}
+
+// mobiPdbName 数据库名只能是 ASCII, 最长 31 字节
+func mobiPdbName(title string) []byte {
+	name := make([]byte, 0, 31)
+	for _, r := range title {
+		if len(name) == 31 {
+			break
+		}
+		if r > ' ' && r < 0x7F {
+			name = append(name, byte(r))
+		} else {
+			name = append(name, '_')
+		}
+	}
+	return name
+}
+
+// mobiEncint 变长整数, 高位在前, 最后一个字节的最高位置 1
+func mobiEncint(value uint32) []byte {
+	encoded := []byte{byte(value&0x7F) | 0x80}
+	for value >>= 7; value > 0; value >>= 7 {
+		encoded = append([]byte{byte(value & 0x7F)}, encoded...)
+	}
+	return encoded
+}
+
+// mobiBase32 KF8 链接中使用的 0-9A-V 编码
+func mobiBase32(value int, width int) string {
+	s := strings.ToUpper(strconv.FormatInt(int64(value), 32))
+	if len(s) < width {
+		s = strings.Repeat("0", width-len(s)) + s
+	}
+	return s
+}
+
+func mobiAlign(data []byte) []byte {
+	aligned := append([]byte(nil), data...)
+	for len(aligned)%4 != 0 {
+		aligned = append(aligned, 0)
+	}
+	return aligned
+}
+
+// mobiFile 从 KF8 文件中读出的记录和元数据, 用于扫描书库和校验
+type mobiFile struct {
+	records [][]byte
+	title   string
+	exth    map[uint32][]string
+}
+
+func readMobi(data []byte) (*mobiFile, error) {
+	be := binary.BigEndian
+	if len(data) < 78 || string(data[60:68]) != "BOOKMOBI" {
+		return nil, fmt.Errorf("invalid mobi header")
+	}
+	count := int(be.Uint16(data[76:]))
+	if count == 0 || 78+8*count > len(data) {
+		return nil, fmt.Errorf("truncated mobi")
+	}
+	m := &mobiFile{exth: make(map[uint32][]string)}
+	for i := 0; i < count; i++ {
+		start, end := int(be.Uint32(data[78+8*i:])), len(data)
+		if i+1 < count {
+			end = int(be.Uint32(data[78+8*(i+1):]))
+		}
+		if start > end || end > len(data) {
+			return nil, fmt.Errorf("truncated mobi")
+		}
+		m.records = append(m.records, data[start:end])
+	}
+
+	record0 := m.records[0]
+	if len(record0) < 24 || string(record0[16:20]) != "MOBI" {
+		return nil, fmt.Errorf("invalid mobi header")
+	}
+	headerLength := int(be.Uint32(record0[20:]))
+	if headerLength < 248 || 16+headerLength > len(record0) {
+		return nil, fmt.Errorf("invalid mobi header")
+	}
+	if version := be.Uint32(record0[36:]); version < 8 {
+		return nil, fmt.Errorf("not a KF8 file (version %d)", version)
+	}
+	titleOffset, titleLength := int(be.Uint32(record0[84:])), int(be.Uint32(record0[88:]))
+	if titleOffset+titleLength <= len(record0) {
+		m.title = string(record0[titleOffset : titleOffset+titleLength])
+	}
+	if be.Uint32(record0[128:])&0x40 != 0 {
+		exth := record0[16+headerLength:]
+		if len(exth) < 12 || string(exth[:4]) != "EXTH" {
+			return nil, fmt.Errorf("invalid EXTH header")
+		}
+		offset := 12
+		for i := 0; i < int(be.Uint32(exth[8:])); i++ {
+			if offset+8 > len(exth) {
+				return nil, fmt.Errorf("invalid EXTH header")
+			}
+			id, length := be.Uint32(exth[offset:]), int(be.Uint32(exth[offset+4:]))
+			if length < 8 || offset+length > len(exth) {
+				return nil, fmt.Errorf("invalid EXTH header")
+			}
+			m.exth[id] = append(m.exth[id], string(exth[offset+8:offset+length]))
+			offset += length
+		}
+	}
+	return m, nil
+}
+
+func (m *mobiFile) header(offset int) int {
+	return int(binary.BigEndian.Uint32(m.records[0][offset:]))
+}
+
+func (m *mobiFile) record(i int) []byte {
+	if i < 0 || i >= len(m.records) {
+		return nil
+	}
+	return m.records[i]
+}
+
+// indexEntries 返回索引头记录中的条目总数, 不是索引时返回 -1
+func (m *mobiFile) indexEntries(i int) int {
+	record := m.record(i)
+	if len(record) < mobiIndxHeader || string(record[:4]) != "INDX" {
+		return -1
+	}
+	return int(binary.BigEndian.Uint32(record[36:]))
+}
+
+// pageCount 每页是一个骨架文件, 页数即骨架索引的条目数
+func (m *mobiFile) pageCount() int {
+	return max(m.indexEntries(m.header(252)), 0)
+}
+
+// images 从第一个资源记录开始的连续图片, 有单独的封面时第一张是封面
+func (m *mobiFile) images() [][]byte {
+	var images [][]byte
+	for i := m.header(108); i >= 0 && i < len(m.records) && isImage(m.records[i]); i++ {
+		images = append(images, m.records[i])
+	}
+	return images
+}
+
+// pageImages 去掉单独的封面后的页面图片
+func (m *mobiFile) pageImages() [][]byte {
+	images := m.images()
+	if pages := m.pageCount(); len(images) > pages {
+		images = images[len(images)-pages:]
+	}
+	return images
+}
+
+// validateMobi 检查 PDB 记录表, 正文长度, FDST, KF8 索引, 图片资源和固定版式设置
+func validateMobi(filePath string) []string {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	m, err := readMobi(data)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !bytes.Equal(m.records[len(m.records)-1], mobiEof) {
+		addProblem("missing EOF record")
+	}
+
+	textLength, textRecords := m.header(4), int(binary.BigEndian.Uint16(m.records[0][8:]))
+	length := 0
+	for i := 1; i <= textRecords; i++ {
+		record := m.record(i)
+		if len(record) == 0 {
+			addProblem("missing text record %d", i)
+			break
+		}
+		length += len(record) - int(record[len(record)-1]&0x3) - 1
+	}
+	if length != textLength {
+		addProblem("text length mismatch: header has %d, records have %d", textLength, length)
+	}
+
+	if fdst := m.record(m.header(192)); len(fdst) < 20 || string(fdst[:4]) != "FDST" {
+		addProblem("missing FDST record")
+	} else if end := int(binary.BigEndian.Uint32(fdst[len(fdst)-4:])); end != textLength {
+		addProblem("FDST ends at %d, text length is %d", end, textLength)
+	}
+
+	skeletons, chunks := m.indexEntries(m.header(252)), m.indexEntries(m.header(248))
+	if skeletons <= 0 {
+		addProblem("missing skeleton index")
+	}
+	if chunks < skeletons {
+		addProblem("fragment index has %d entries for %d skeletons", chunks, skeletons)
+	}
+	if m.indexEntries(m.header(244)) <= 0 {
+		addProblem("missing NCX index")
+	}
+
+	images := m.images()
+	if len(images) < skeletons {
+		addProblem("%d images for %d pages", len(images), skeletons)
+	}
+	for i, img := range images {
+		if _, format, err := image.DecodeConfig(bytes.NewReader(img)); err != nil {
+			addProblem("image %d: %v", i+1, err)
+		} else if format != "jpeg" && format != "png" && format != "gif" {
+			addProblem("image %d: unsupported format %s", i+1, format)
+		}
+	}
+	if covers := m.exth[201]; len(covers) == 0 || len(covers[0]) != 4 {
+		addProblem("missing cover")
+	} else if cover := int(binary.BigEndian.Uint32([]byte(covers[0]))); cover >= len(images) {
+		addProblem("cover offset %d out of range", cover)
+	}
+	if fixed := m.exth[122]; len(fixed) == 0 || fixed[0] != "true" {
+		addProblem("not fixed-layout")
+	}
+	return problems
+}
+
+// verifyMobi 检查记录表和结尾标记, 校验图片并核对页数
+func verifyMobi(filePath string, pageCount int) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	m, err := readMobi(data)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(m.records[len(m.records)-1], mobiEof) {
+		return fmt.Errorf("truncated mobi")
+	}
+	for i, img := range m.images() {
+		if _, err := checkImage(bytes.NewReader(img), int64(len(img)), ImageCheckHeader); err != nil {
+			return fmt.Errorf("image %d: %v", i+1, err)
+		}
+	}
+	if pages := m.pageCount(); pageCount > 0 && pages != pageCount {
+		return fmt.Errorf("page count mismatch: expected %d, found %d", pageCount, pages)
+	}
+	return nil
+}
+
+// readMobiMeta 从 EXTH 中读取标题, 漫画 UUID 和章节网址.
+// 标题中的系列名前缀会被去掉
+func readMobiMeta(file string, format string) (*scannedFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m, err := readMobi(data)
+	if err != nil {
+		return nil, err
+	}
+	scanned := &scannedFile{path: file, format: format, pageCount: m.pageCount(), title: m.title}
+	if titles := m.exth[503]; len(titles) > 0 {
+		scanned.title = titles[0]
+	}
+	for _, identifier := range m.exth[113] {
+		if uuid := uuidPattern.FindString(identifier); uuid != "" {
+			scanned.comicUUID = uuid
+		}
+	}
+	for _, source := range m.exth[112] {
+		if scanned.readIdentity(source) {
+			break
+		}
+		if match := comicUrlPattern.FindStringSubmatch(source); match != nil {
+			scanned.pathWord = match[1]
+			if match[2] != "" {
+				scanned.chapterUUIDs = []string{match[2]}
+			}
+		}
+	}
+	fillScannedNames(scanned)
+	scanned.title = strings.TrimPrefix(scanned.title, scanned.series+" ")
+	return scanned, nil
+}
+
+// readMobiImages 按顺序读取页面图片, 不含单独的封面
+func readMobiImages(file string) ([]archiveEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m, err := readMobi(data)
+	if err != nil {
+		return nil, err
+	}
+	var entries []archiveEntry
+	for i, img := range m.pageImages() {
+		_, format, err := image.DecodeConfig(bytes.NewReader(img))
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %v", i+1, err)
+		}
+		if format == "jpeg" {
+			format = "jpg"
+		}
+		entries = append(entries, archiveEntry{Name: fmt.Sprintf("%04d.%s", i+1, format), Data: img})
+	}
+	return entries, nil
+}
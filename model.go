@@ -9,6 +9,9 @@ type Comic struct {
 	Theme    []PathWord `json:"theme"`
 	Brief    string     `json:"brief"`
 	Region   Display    `json:"region"`
+	// 连载状态, 1 为已完结
+	Status   Display `json:"status"`
+	Restrict Display `json:"restrict"`
 }
 
 type Display struct {
@@ -27,6 +30,15 @@ type ChapterInfo struct {
 	Count int    `json:"count"`
 	Size  int    `json:"size"`
 	Name  string `json:"name"`
+	// 章节类型, 1 话, 2 卷, 3 番外
+	Type int `json:"type"`
+	// 所属分组和更新日期
+	GroupPathWord   string `json:"group_path_word"`
+	DatetimeCreated string `json:"datetime_created"`
+	// 是否已下载到本地
+	Local bool `json:"local"`
+	// 本地章节下载后源站是否有更新
+	Changed bool `json:"changed"`
 }
 
 type Chapter struct {
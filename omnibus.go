@@ -0,0 +1,244 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// buildOmnibus 把漫画在本地已下载的所有章节合并为一本 EPUB, 以封面为第一页,
+// 每个章节在目录中占一项. 返回生成的文件路径
+func buildOmnibus(downloader *Downloader) (string, error) {
+	bookInfo := downloader.bookInfo
+	chapters := LibraryInstance.localChapters(bookInfo.UUID, downloader.pathWord)
+	if len(chapters) == 0 {
+		return "", fmt.Errorf("本地没有 %s 的章节", bookInfo.Series)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "omnibus-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// 合并下载的章节共用一个文件, 只加入一次
+	files := make(map[string]bool)
+	var comicChapters []ComicChapter
+	var failed []string
+	uuids := make([]string, len(chapters))
+	for i, chapter := range chapters {
+		uuids[i] = chapter.UUID
+	}
+	for _, chapter := range chapters {
+		if files[chapter.FilePath] {
+			continue
+		}
+		files[chapter.FilePath] = true
+		title := chapter.Name
+		if chapter.Bundle != "" {
+			title = chapter.Bundle
+		}
+		imgPath := filepath.Join(tmpDir, fmt.Sprintf("%03d", len(comicChapters)+1))
+		if err := extractChapterImages(chapter, imgPath); err != nil {
+			fmt.Fprintln(logOutput, "Error reading chapter:", fmt.Errorf("%s: %v", chapter.FilePath, err))
+			failed = append(failed, title)
+			continue
+		}
+		comicChapters = append(comicChapters, ComicChapter{Title: title, ImgPath: imgPath})
+	}
+	// 缺少章节时不生成合集, 避免得到一本缺页的书
+	if len(failed) > 0 {
+		return "", fmt.Errorf("%s 未生成, 无法读取的章节: %s", bookInfo.Series, strings.Join(failed, ", "))
+	}
+
+	// NewMetaData 会转义传入的字段, 不能直接传 bookInfo 中字段的指针
+	author, description, series := bookInfo.Author, bookInfo.Description, bookInfo.Series
+	comicUUID := bookInfo.UUID
+	if comicUUID == "" {
+		comicUUID = stableUUID(downloader.pathWord, bookInfo.Series)
+	}
+	identifier := "urn:uuid:" + comicUUID
+	var subject []string
+	if bookInfo.Genre != "" {
+		subject = strings.Split(bookInfo.Genre, ", ")
+	}
+	epubBuilder := EpubBuilder{
+		metadata: NewMetaData(bookInfo.Series, &author, nil, &description, &series, subject, nil, nil, &identifier),
+		rtl:      bookInfo.rightToLeft(),
+		identity: fileIdentity(downloader.pathWord, bookInfo.UUID, uuids),
+	}
+	cover, ext, err := fetchCover(bookInfo.Cover)
+	if err != nil {
+		fmt.Fprintln(logOutput, "Error downloading cover:", err)
+	} else {
+		epubBuilder.imgDataList = [][]byte{cover}
+		epubBuilder.extList = []string{ext}
+	}
+
+	path := filepath.Join(downloader.config.OutputPath, sanitizeFilename(bookInfo.Series)+".epub")
+	err = buildVersioned(path, downloader.config.versionRetention(), func(tmpPath string) error {
+		if err := epubBuilder.BuildComicChapters(tmpPath, comicChapters); err != nil {
+			return err
+		}
+		if err := validatePackage(tmpPath, "epub"); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// localChapters 返回漫画在本地的章节, 默认分组在前, 同一分组内按序号排列
+func (l *Library) localChapters(comicUUID string, pathWord string) []LibraryChapter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	comic := l.findComic(comicUUID, pathWord)
+	if comic == nil {
+		return nil
+	}
+	list := make([]LibraryChapter, 0, len(comic.Chapters))
+	for _, chapter := range comic.Chapters {
+		list = append(list, *chapter)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Group != b.Group {
+			if a.Group == "default" || b.Group == "default" {
+				return a.Group == "default"
+			}
+			return a.Group < b.Group
+		}
+		return a.Index < b.Index
+	})
+	return list
+}
+
+// extractChapterImages 把章节文件中的图片按顺序写入 dir, PDF 不支持
+func extractChapterImages(chapter LibraryChapter, dir string) error {
+	info, err := os.Stat(chapter.FilePath)
+	if err != nil {
+		return err
+	}
+
+	var entries []archiveEntry
+	switch {
+	case info.IsDir():
+		files, err := os.ReadDir(chapter.FilePath)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if file.IsDir() || isTempFile(file.Name()) || !isImageName(file.Name()) {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(chapter.FilePath, file.Name()))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, archiveEntry{Name: file.Name(), Data: data})
+		}
+	case chapter.Format == "cbt":
+		entries, err = readTarEntries(chapter.FilePath)
+		if err != nil {
+			return err
+		}
+	case chapter.Format == "pdf":
+		return fmt.Errorf("不支持从 PDF 中读取图片")
+	case chapter.Format == "mobi" || chapter.Format == "azw3":
+		entries, err = readMobiImages(chapter.FilePath)
+		if err != nil {
+			return err
+		}
+	default:
+		entries, err = readZipImages(chapter.FilePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var images []archiveEntry
+	for _, entry := range entries {
+		if isImageName(entry.Name) {
+			images = append(images, entry)
+		}
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("没有图片")
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Name < images[j].Name })
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	for i, entry := range images {
+		name := fmt.Sprintf("%04d%s", i+1, strings.ToLower(filepath.Ext(entry.Name)))
+		if err := os.WriteFile(filepath.Join(dir, name), entry.Data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readZipImages 读取 zip, cbz 或 epub 中的图片, EPUB 单独的封面图片不算作页面
+func readZipImages(file string) ([]archiveEntry, error) {
+	reader, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	covers := make(map[string]bool)
+	if opf, opfPath, err := readOpf(&reader.Reader); err == nil {
+		for i, item := range opf.Manifest.Items {
+			if opf.isSeparateCover(i) {
+				covers[filepath.ToSlash(filepath.Join(filepath.Dir(opfPath), item.Href))] = true
+			}
+		}
+	}
+
+	var entries []archiveEntry
+	for _, f := range reader.File {
+		if !isImageName(f.Name) || covers[f.Name] {
+			continue
+		}
+		data, err := readZipEntry(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		entries = append(entries, archiveEntry{Name: f.Name, Data: data})
+	}
+	return entries, nil
+}
+
+// fetchCover 下载封面, 返回图片数据和扩展名
+func fetchCover(url string) ([]byte, string, error) {
+	if url == "" {
+		return nil, "", fmt.Errorf("没有封面")
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid cover: %v", err)
+	}
+	if format == "jpeg" {
+		format = "jpg"
+	}
+	return data, "." + format, nil
+}
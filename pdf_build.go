@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// PdfBuilder 把图片目录打包为 PDF, 每页大小与图片一致.
+// JPEG 和不透明的 PNG 直接嵌入原始数据, 其余格式解码后重新压缩
+type PdfBuilder struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	// fileIdentity 生成的标识, 写入文档信息供扫描书库时匹配
+	Identity string
+	chapters []pdfChapter
+}
+
+type pdfChapter struct {
+	title string
+	pages []string
+}
+
+// AddChapter 添加一个章节的图片目录, 章节多于一个时会生成书签
+func (pb *PdfBuilder) AddChapter(title string, imgPath string) error {
+	pages, err := listPageFiles(imgPath)
+	if err != nil {
+		return err
+	}
+	pb.chapters = append(pb.chapters, pdfChapter{title: title, pages: pages})
+	return nil
+}
+
+func (pb *PdfBuilder) Build(path string) error {
+	return atomicWriteFile(path, func(f *os.File) error {
+		w := &pdfWriter{w: bufio.NewWriter(f), offsets: make(map[int]int64)}
+		if err := pb.write(w); err != nil {
+			return err
+		}
+		return w.w.Flush()
+	})
+}
+
+func (pb *PdfBuilder) write(w *pdfWriter) error {
+	w.printf("%%PDF-1.5\n%%\xe2\xe3\xcf\xd3\n")
+	catalogID, pagesID, infoID := w.alloc(), w.alloc(), w.alloc()
+
+	var kids []string
+	firstPages := make([]int, len(pb.chapters))
+	for i, chapter := range pb.chapters {
+		for j, page := range chapter.pages {
+			img, err := loadPdfImage(page)
+			if err != nil {
+				return fmt.Errorf("%s: %v", filepath.Base(page), err)
+			}
+			imageID, contentID, pageID := w.alloc(), w.alloc(), w.alloc()
+			w.stream(imageID, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d %s",
+				img.width, img.height, img.dict), img.data)
+			content := fmt.Sprintf("q %d 0 0 %d 0 0 cm /Im0 Do Q", img.width, img.height)
+			w.stream(contentID, "", []byte(content))
+			w.object(pageID, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] "+
+				"/Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+				pagesID, img.width, img.height, imageID, contentID))
+			kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+			if j == 0 {
+				firstPages[i] = pageID
+			}
+		}
+	}
+	if len(kids) == 0 {
+		return fmt.Errorf("no pages to write")
+	}
+	w.object(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+
+	catalog := fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R", pagesID)
+	if outlinesID := pb.writeOutlines(w, firstPages); outlinesID != 0 {
+		catalog += fmt.Sprintf(" /Outlines %d 0 R /PageMode /UseOutlines", outlinesID)
+	}
+	w.object(catalogID, catalog+" >>")
+
+	info := "<< /Creator " + pdfText("copymanga-downloader")
+	for _, field := range [][2]string{
+		{"Title", pb.Title}, {"Author", pb.Author}, {"Subject", pb.Subject}, {"Keywords", pb.Keywords},
+	} {
+		if field[1] != "" {
+			info += " /" + field[0] + " " + pdfText(field[1])
+		}
+	}
+	if pb.Identity != "" {
+		// 标识只含 ASCII 字符, 以明文写入便于读取
+		info += " /CopymangaIdentity (" + pb.Identity + ")"
+	}
+	info += fmt.Sprintf(" /CreationDate (D:%sZ) >>", time.Now().UTC().Format("20060102150405"))
+	w.object(infoID, info)
+
+	w.trailer(catalogID, infoID)
+	return nil
+}
+
+// writeOutlines 为每个章节生成指向第一页的书签, 只有一个章节时不生成
+func (pb *PdfBuilder) writeOutlines(w *pdfWriter, firstPages []int) int {
+	var items []int
+	var titles []string
+	var targets []int
+	for i, chapter := range pb.chapters {
+		if len(chapter.pages) == 0 {
+			continue
+		}
+		titles = append(titles, chapter.title)
+		targets = append(targets, firstPages[i])
+	}
+	if len(targets) < 2 {
+		return 0
+	}
+	outlinesID := w.alloc()
+	for range targets {
+		items = append(items, w.alloc())
+	}
+	for i, id := range items {
+		item := fmt.Sprintf("<< /Title %s /Parent %d 0 R /Dest [%d 0 R /Fit]", pdfText(titles[i]), outlinesID, targets[i])
+		if i > 0 {
+			item += fmt.Sprintf(" /Prev %d 0 R", items[i-1])
+		}
+		if i < len(items)-1 {
+			item += fmt.Sprintf(" /Next %d 0 R", items[i+1])
+		}
+		w.object(id, item+" >>")
+	}
+	w.object(outlinesID, fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>",
+		items[0], items[len(items)-1], len(items)))
+	return outlinesID
+}
+
+// pdfWriter 记录每个对象的偏移量以生成 xref 表
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int64
+	offsets map[int]int64
+	next    int
+}
+
+func (pw *pdfWriter) alloc() int {
+	pw.next++
+	return pw.next
+}
+
+func (pw *pdfWriter) printf(format string, args ...interface{}) {
+	n, _ := fmt.Fprintf(pw.w, format, args...)
+	pw.offset += int64(n)
+}
+
+func (pw *pdfWriter) object(id int, body string) {
+	pw.offsets[id] = pw.offset
+	pw.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (pw *pdfWriter) stream(id int, dict string, data []byte) {
+	pw.offsets[id] = pw.offset
+	pw.printf("%d 0 obj\n<< %s /Length %d >>\nstream\n", id, dict, len(data))
+	n, _ := pw.w.Write(data)
+	pw.offset += int64(n)
+	pw.printf("\nendstream\nendobj\n")
+}
+
+func (pw *pdfWriter) trailer(rootID int, infoID int) {
+	xref := pw.offset
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", pw.next+1)
+	for id := 1; id <= pw.next; id++ {
+		pw.printf("%010d 00000 n \n", pw.offsets[id])
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", pw.next+1, rootID, infoID, xref)
+}
+
+var pdfPagePattern = regexp.MustCompile(`/Type\s*/Page[^s]`)
+
+// pdfPageCount 统计页面对象的数量, 不支持对象流压缩的 PDF
+func pdfPageCount(data []byte) int {
+	return len(pdfPagePattern.FindAllIndex(data, -1))
+}
+
+// pdfText 把文本编码为带 BOM 的 UTF-16BE 十六进制字符串
+func pdfText(text string) string {
+	units := utf16.Encode([]rune(text))
+	buf := make([]byte, 2+2*len(units))
+	buf[0], buf[1] = 0xFE, 0xFF
+	for i, unit := range units {
+		binary.BigEndian.PutUint16(buf[2+2*i:], unit)
+	}
+	return "<" + strings.ToUpper(hex.EncodeToString(buf)) + ">"
+}
+
+type pdfImage struct {
+	width  int
+	height int
+	// 图片对象中除尺寸外的字典内容
+	dict string
+	data []byte
+}
+
+func loadPdfImage(path string) (*pdfImage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "jpeg":
+		colorSpace := "/DeviceRGB"
+		switch config.ColorModel {
+		case color.GrayModel:
+			colorSpace = "/DeviceGray"
+		case color.CMYKModel:
+			// Adobe 写入的 CMYK JPEG 是反相的
+			colorSpace = "/DeviceCMYK /Decode [1 0 1 0 1 0 1 0]"
+		}
+		return &pdfImage{
+			width:  config.Width,
+			height: config.Height,
+			dict:   "/ColorSpace " + colorSpace + " /BitsPerComponent 8 /Filter /DCTDecode",
+			data:   data,
+		}, nil
+	case "png":
+		if img := pngPdfImage(data); img != nil {
+			return img, nil
+		}
+	}
+	return encodePdfImage(data)
+}
+
+// pngPdfImage 直接使用 PNG 的 IDAT 数据, PDF 的 FlateDecode 支持 PNG 预测器.
+// 隔行扫描或带透明通道的图片返回 nil
+func pngPdfImage(data []byte) *pdfImage {
+	var width, height, bitDepth, colorType, interlace int
+	var palette []byte
+	var idat bytes.Buffer
+	for offset := 8; offset+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		chunk := string(data[offset+4 : offset+8])
+		start := offset + 8
+		if length < 0 || start+length+4 > len(data) {
+			return nil
+		}
+		body := data[start : start+length]
+		switch chunk {
+		case "IHDR":
+			if length < 13 {
+				return nil
+			}
+			width = int(binary.BigEndian.Uint32(body[0:]))
+			height = int(binary.BigEndian.Uint32(body[4:]))
+			bitDepth, colorType, interlace = int(body[8]), int(body[9]), int(body[12])
+		case "PLTE":
+			palette = body
+		case "tRNS":
+			return nil
+		case "IDAT":
+			idat.Write(body)
+		}
+		offset = start + length + 4
+	}
+	if interlace != 0 || width == 0 || height == 0 || idat.Len() == 0 {
+		return nil
+	}
+
+	var colorSpace string
+	colors := 1
+	switch colorType {
+	case 0:
+		colorSpace = "/DeviceGray"
+	case 2:
+		colorSpace = "/DeviceRGB"
+		colors = 3
+	case 3:
+		if len(palette) == 0 {
+			return nil
+		}
+		colorSpace = fmt.Sprintf("[/Indexed /DeviceRGB %d <%s>]", len(palette)/3-1, hex.EncodeToString(palette))
+	default:
+		return nil
+	}
+	return &pdfImage{
+		width:  width,
+		height: height,
+		dict: fmt.Sprintf("/ColorSpace %s /BitsPerComponent %d /Filter /FlateDecode "+
+			"/DecodeParms << /Predictor 15 /Colors %d /BitsPerComponent %d /Columns %d >>",
+			colorSpace, bitDepth, colors, bitDepth, width),
+		data: idat.Bytes(),
+	}
+}
+
+// encodePdfImage 解码图片并以 RGB 重新压缩, 透明部分合成到白色背景上
+func encodePdfImage(data []byte) (*pdfImage, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	row := make([]byte, 0, bounds.Dx()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			white := 0xffff - a
+			row = append(row, byte((r+white)>>8), byte((g+white)>>8), byte((b+white)>>8))
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &pdfImage{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		dict:   "/ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+		data:   buf.Bytes(),
+	}, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	EventTaskAdded   = "task:added"
+	EventTaskUpdated = "task:updated"
+	EventTaskRemoved = "task:removed"
+	// 完整的任务列表, 服务器模式在事件连接建立时发送
+	EventTaskReset = "task:reset"
+)
+
+// progressEmitter 合并任务的增删改事件, 按固定间隔批量发送
+type progressEmitter struct {
+	mu      sync.Mutex
+	added   map[int64]*DownloaderSingle
+	updated map[int64]*DownloaderSingle
+	removed map[int64]struct{}
+	emit    func(eventName string, data ...interface{})
+}
+
+func newProgressEmitter(emit func(eventName string, data ...interface{})) *progressEmitter {
+	return &progressEmitter{
+		added:   make(map[int64]*DownloaderSingle),
+		updated: make(map[int64]*DownloaderSingle),
+		removed: make(map[int64]struct{}),
+		emit:    emit,
+	}
+}
+
+func (p *progressEmitter) Added(task *DownloaderSingle) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.added[task.ID] = task
+}
+
+func (p *progressEmitter) Updated(task *DownloaderSingle) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 尚未发送的新增事件会带上最新状态
+	if _, ok := p.added[task.ID]; ok {
+		return
+	}
+	p.updated[task.ID] = task
+}
+
+func (p *progressEmitter) Removed(task *DownloaderSingle) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.added[task.ID]; ok {
+		// 前端还不知道这个任务, 直接丢弃
+		delete(p.added, task.ID)
+		return
+	}
+	delete(p.updated, task.ID)
+	p.removed[task.ID] = struct{}{}
+}
+
+// Flush 立即发送所有待发送的事件
+func (p *progressEmitter) Flush() {
+	p.mu.Lock()
+	added := sortedTasks(p.added)
+	updated := sortedTasks(p.updated)
+	removed := make([]int64, 0, len(p.removed))
+	for id := range p.removed {
+		removed = append(removed, id)
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i] < removed[j] })
+	p.added = make(map[int64]*DownloaderSingle)
+	p.updated = make(map[int64]*DownloaderSingle)
+	p.removed = make(map[int64]struct{})
+	p.mu.Unlock()
+
+	if len(added) > 0 {
+		p.emit(EventTaskAdded, added)
+	}
+	if len(updated) > 0 {
+		p.emit(EventTaskUpdated, updated)
+	}
+	if len(removed) > 0 {
+		p.emit(EventTaskRemoved, removed)
+	}
+}
+
+// Run 按 interval 周期发送事件, 直到 ctx 结束
+func (p *progressEmitter) Run(ctx context.Context, interval func() time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			p.Flush()
+			return
+		case <-time.After(interval()):
+			p.Flush()
+		}
+	}
+}
+
+func sortedTasks(tasks map[int64]*DownloaderSingle) []*DownloaderSingle {
+	list := make([]*DownloaderSingle, 0, len(tasks))
+	for _, task := range tasks {
+		list = append(list, task)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
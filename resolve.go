@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ResolvedInput 用户输入解析出的漫画和章节
+type ResolvedInput struct {
+	PathWord    string `json:"pathWord"`
+	ChapterUUID string `json:"chapterUUID"`
+	// 章节链接会直接加入下载队列
+	Queued bool `json:"queued"`
+}
+
+var (
+	urlInTextPattern  = regexp.MustCompile(`(?i)(?:https?|copymanga)://[^\s"'<>]+`)
+	rawPathWordRegexp = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+	// 按优先级排列, 带章节的规则在前
+	chapterUrlPatterns = []*regexp.Regexp{
+		// https://www.mangacopy.com/comic/<pw>/chapter/<uuid>
+		// https://api.mangacopy.com/api/v3/comic/<pw>/chapter2/<uuid>
+		regexp.MustCompile(`/comic/([^/?#]+)/chapter2?/([0-9a-fA-F-]{36})`),
+		// https://m.mangacopy.com/h5/comicContent/<pw>/<uuid>
+		regexp.MustCompile(`/comicContent/([^/?#]+)/([0-9a-fA-F-]{36})`),
+	}
+	comicUrlPatterns = []*regexp.Regexp{
+		// https://m.mangacopy.com/h5/details/comic/<pw>
+		regexp.MustCompile(`/details/comic/([^/?#]+)`),
+		// https://www.mangacopy.com/comic/<pw>, /api/v3/comic2/<pw>
+		regexp.MustCompile(`/comic2?/([^/?#]+)`),
+	}
+)
+
+// ResolveInput 解析 path word、漫画链接、章节链接、移动端和 App 分享链接,
+// 不限定域名, 镜像站同样适用
+func ResolveInput(input string) (ResolvedInput, error) {
+	input = strings.TrimSpace(input)
+	if rawPathWordRegexp.MatchString(input) {
+		return ResolvedInput{PathWord: input}, nil
+	}
+
+	// 分享文本中通常夹杂着标题等文字
+	link := urlInTextPattern.FindString(input)
+	if link == "" {
+		if strings.Contains(input, "/") {
+			link = "https://" + strings.TrimPrefix(input, "//")
+		} else {
+			return ResolvedInput{}, fmt.Errorf("无法识别的输入: %s", input)
+		}
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ResolvedInput{}, fmt.Errorf("无法识别的链接: %s", link)
+	}
+	// copymanga://comic/<pw> 这类链接的第一段会被解析为 host
+	path := u.Path
+	if !strings.HasPrefix(strings.ToLower(u.Scheme), "http") {
+		path = "/" + u.Host + u.Path
+	}
+
+	for _, pattern := range chapterUrlPatterns {
+		if match := pattern.FindStringSubmatch(path); match != nil {
+			return ResolvedInput{PathWord: match[1], ChapterUUID: strings.ToLower(match[2])}, nil
+		}
+	}
+	for _, pattern := range comicUrlPatterns {
+		if match := pattern.FindStringSubmatch(path); match != nil {
+			return ResolvedInput{PathWord: match[1]}, nil
+		}
+	}
+	// 部分分享链接把 path word 放在查询参数中
+	for _, key := range []string{"path_word", "pathWord", "comic"} {
+		if pathWord := u.Query().Get(key); pathWord != "" {
+			return ResolvedInput{PathWord: pathWord, ChapterUUID: u.Query().Get("uuid")}, nil
+		}
+	}
+	return ResolvedInput{}, fmt.Errorf("无法识别的链接: %s", link)
+}
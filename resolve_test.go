@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestResolveInput(t *testing.T) {
+	const uuid = "6e7f8a9b-0000-11ee-8000-0242ac120002"
+	tests := []struct {
+		input       string
+		pathWord    string
+		chapterUUID string
+	}{
+		{"yaoshenji", "yaoshenji", ""},
+		{"  yaoshenji\n", "yaoshenji", ""},
+		{"https://www.mangacopy.com/comic/yaoshenji", "yaoshenji", ""},
+		{"https://www.mangacopy.com/comic/yaoshenji/chapter/" + uuid, "yaoshenji", uuid},
+		{"https://api.mangacopy.com/api/v3/comic/yaoshenji/chapter2/" + uuid, "yaoshenji", uuid},
+		{"https://api.mangacopy.com/api/v3/comic2/yaoshenji", "yaoshenji", ""},
+		{"https://m.mangacopy.com/h5/details/comic/yaoshenji", "yaoshenji", ""},
+		{"https://m.mangacopy.com/h5/comicContent/yaoshenji/" + uuid, "yaoshenji", uuid},
+		// 镜像站和大写的章节 UUID
+		{"https://copymanga.site/comic/yaoshenji/chapter/6E7F8A9B-0000-11EE-8000-0242AC120002", "yaoshenji", uuid},
+		{"copymanga://comic/yaoshenji", "yaoshenji", ""},
+		{"《妖神记》 https://www.mangacopy.com/comic/yaoshenji 来自拷贝漫画", "yaoshenji", ""},
+		{"www.mangacopy.com/comic/yaoshenji", "yaoshenji", ""},
+		{"https://share.mangacopy.com/s?path_word=yaoshenji&uuid=" + uuid, "yaoshenji", uuid},
+	}
+	for _, tt := range tests {
+		got, err := ResolveInput(tt.input)
+		if err != nil {
+			t.Errorf("ResolveInput(%q): %v", tt.input, err)
+			continue
+		}
+		if got.PathWord != tt.pathWord || got.ChapterUUID != tt.chapterUUID {
+			t.Errorf("ResolveInput(%q) = %q %q, want %q %q", tt.input, got.PathWord, got.ChapterUUID, tt.pathWord, tt.chapterUUID)
+		}
+	}
+}
+
+func TestResolveInputInvalid(t *testing.T) {
+	for _, input := range []string{"", "妖神记", "https://www.mangacopy.com/", "https://www.mangacopy.com/rank"} {
+		if got, err := ResolveInput(input); err == nil {
+			t.Errorf("ResolveInput(%q) = %+v, want error", input, got)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 任务状态
+const (
+	TaskStateQueued  = "queued"  // 排队中
+	TaskStateWaiting = "waiting" // 等待时间窗口或开始时间
+	TaskStateRunning = "running"
+	TaskStateDone    = "done"
+	TaskStateFailed  = "failed"
+)
+
+// 调度器状态
+const (
+	SchedulerIdle    = "idle"
+	SchedulerRunning = "running"
+	SchedulerWaiting = "waiting" // 有任务排队, 但不在时间窗口内
+)
+
+const EventSchedulerState = "scheduler:state"
+
+// ScheduleConfig 下载时间窗口配置, 未启用时任务随时可以开始
+type ScheduleConfig struct {
+	Enabled bool         `json:"enabled"`
+	Windows []TimeWindow `json:"windows"`
+}
+
+// TimeWindow 某个星期几的可下载时段, Start 晚于 End 时表示跨越午夜
+type TimeWindow struct {
+	Weekday time.Weekday `json:"weekday"`
+	Start   string       `json:"start"` // 15:04
+	End     string       `json:"end"`   // 15:04
+}
+
+type SchedulerState struct {
+	State    string    `json:"state"`
+	Queued   int       `json:"queued"`
+	Running  int       `json:"running"`
+	InWindow bool      `json:"inWindow"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Allows 判断 t 是否落在任一时间窗口内
+func (s *ScheduleConfig) Allows(t time.Time) bool {
+	if s == nil || !s.Enabled || len(s.Windows) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	yesterday := (t.Weekday() + 6) % 7
+	for _, window := range s.Windows {
+		start, err1 := parseClock(window.Start)
+		end, err2 := parseClock(window.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if start <= end {
+			if window.Weekday == t.Weekday() && minute >= start && minute < end {
+				return true
+			}
+			continue
+		}
+		// 跨越午夜: 当天 start 之后, 或前一天开始的窗口在次日 end 之前
+		if window.Weekday == t.Weekday() && minute >= start {
+			return true
+		}
+		if window.Weekday == yesterday && minute < end {
+			return true
+		}
+	}
+	return false
+}
+
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %v", clock, err)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Scheduler 维护待下载队列, 只在时间窗口内且到达开始时间后启动任务
+type Scheduler struct {
+	mu             sync.Mutex
+	queue          []*DownloaderSingle
+	running        int
+	comicNotBefore map[string]time.Time
+	state          SchedulerState
+	wake           chan struct{}
+
+	config        func() *ScheduleConfig
+	onTaskChange  func(*DownloaderSingle)
+	onStateChange func(SchedulerState)
+}
+
+func NewScheduler(config func() *ScheduleConfig, onTaskChange func(*DownloaderSingle), onStateChange func(SchedulerState)) *Scheduler {
+	return &Scheduler{
+		comicNotBefore: make(map[string]time.Time),
+		state:          SchedulerState{State: SchedulerIdle, InWindow: true},
+		wake:           make(chan struct{}, 1),
+		config:         config,
+		onTaskChange:   onTaskChange,
+		onStateChange:  onStateChange,
+	}
+}
+
+func (s *Scheduler) Enqueue(tasks ...*DownloaderSingle) {
+	s.mu.Lock()
+	for _, task := range tasks {
+		if notBefore, ok := s.comicNotBefore[task.PathWord]; ok && task.getNotBefore().IsZero() {
+			task.setNotBefore(notBefore)
+		}
+		task.setState(TaskStateQueued)
+		s.queue = append(s.queue, task)
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// SetTaskNotBefore 设置排队任务的最早开始时间, 零值表示不限制
+func (s *Scheduler) SetTaskNotBefore(id int64, notBefore time.Time) error {
+	var found *DownloaderSingle
+	s.mu.Lock()
+	for _, task := range s.queue {
+		if task.ID == id {
+			task.setNotBefore(notBefore)
+			found = task
+			break
+		}
+	}
+	s.mu.Unlock()
+	if found == nil {
+		return fmt.Errorf("task %d is not queued", id)
+	}
+	s.onTaskChange(found)
+	s.notify()
+	return nil
+}
+
+// SetComicNotBefore 设置整部漫画的最早开始时间, 对之后加入的任务同样生效
+func (s *Scheduler) SetComicNotBefore(pathWord string, notBefore time.Time) {
+	var changed []*DownloaderSingle
+	s.mu.Lock()
+	if notBefore.IsZero() {
+		delete(s.comicNotBefore, pathWord)
+	} else {
+		s.comicNotBefore[pathWord] = notBefore
+	}
+	for _, task := range s.queue {
+		if task.PathWord == pathWord {
+			task.setNotBefore(notBefore)
+			changed = append(changed, task)
+		}
+	}
+	s.mu.Unlock()
+	for _, task := range changed {
+		s.onTaskChange(task)
+	}
+	s.notify()
+}
+
+func (s *Scheduler) State() SchedulerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Pending 返回排队和正在运行的任务数
+func (s *Scheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue) + s.running
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 循环调度任务直到 ctx 结束, run 在独立的协程中执行单个任务
+func (s *Scheduler) Run(ctx context.Context, run func(*DownloaderSingle)) {
+	for {
+		s.dispatch(run)
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-time.After(30 * time.Second):
+			// 定期检查时间窗口和开始时间
+		}
+	}
+}
+
+// dispatch 启动可以运行的任务. 回调在释放 s.mu 后调用, 避免回调中再调用 Scheduler 时死锁
+func (s *Scheduler) dispatch(run func(*DownloaderSingle)) {
+	var changed []*DownloaderSingle
+	s.mu.Lock()
+	now := time.Now()
+	inWindow := s.config().Allows(now)
+	remaining := s.queue[:0]
+	for _, task := range s.queue {
+		ready := inWindow && !now.Before(task.getNotBefore())
+		if ready && s.running < maxConcurrency {
+			s.running++
+			task.setState(TaskStateRunning)
+			changed = append(changed, task)
+			go func(task *DownloaderSingle) {
+				run(task)
+				s.mu.Lock()
+				s.running--
+				s.mu.Unlock()
+				s.notify()
+			}(task)
+			continue
+		}
+		state := TaskStateQueued
+		if !ready {
+			state = TaskStateWaiting
+		}
+		if task.getState() != state {
+			task.setState(state)
+			changed = append(changed, task)
+		}
+		remaining = append(remaining, task)
+	}
+	s.queue = remaining
+
+	state := SchedulerState{
+		State:    SchedulerIdle,
+		Queued:   len(s.queue),
+		Running:  s.running,
+		InWindow: inWindow,
+	}
+	if s.running > 0 {
+		state.State = SchedulerRunning
+	} else if len(s.queue) > 0 {
+		state.State = SchedulerWaiting
+	}
+	state.Updated = s.state.Updated
+	stateChanged := state != s.state
+	if stateChanged {
+		state.Updated = now
+		s.state = state
+	}
+	s.mu.Unlock()
+
+	for _, task := range changed {
+		s.onTaskChange(task)
+	}
+	if stateChanged {
+		s.onStateChange(state)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SelectChapters 按选择表达式从章节列表中选出章节, 返回章节下标.
+//
+// 表达式由逗号分隔的子句组成, 结果为各子句的并集; 子句内用空格或 + 连接的条件取交集.
+// 支持的条件:
+//
+//	all              全部章节
+//	3, 1-20          按序号选择, 序号从 1 开始
+//	latest:5         最新的 5 话
+//	after:<uuid>     指定章节之后的章节
+//	since:2026-01-01 该日期及之后更新的章节
+//	group:tankobon   属于该分组的章节
+//	name~番外        名称包含关键字的章节
+//	missing          本地还没有的章节, 需要先调用 Library.markLocal
+func SelectChapters(expr string, chapters []*ChapterInfo) ([]int, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		expr = "all"
+	}
+
+	selected := make([]bool, len(chapters))
+	for _, clause := range strings.Split(expr, ",") {
+		terms := strings.FieldsFunc(clause, func(r rune) bool { return r == ' ' || r == '+' })
+		if len(terms) == 0 {
+			continue
+		}
+		matched := make([]bool, len(chapters))
+		for i := range matched {
+			matched[i] = true
+		}
+		for _, term := range terms {
+			termMatched, err := selectTerm(term, chapters)
+			if err != nil {
+				return nil, err
+			}
+			for i := range matched {
+				matched[i] = matched[i] && termMatched[i]
+			}
+		}
+		for i := range selected {
+			selected[i] = selected[i] || matched[i]
+		}
+	}
+
+	indexes := []int{}
+	for i, ok := range selected {
+		if ok {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes, nil
+}
+
+func selectTerm(term string, chapters []*ChapterInfo) ([]bool, error) {
+	matched := make([]bool, len(chapters))
+	each := func(match func(i int, chapter *ChapterInfo) bool) []bool {
+		for i, chapter := range chapters {
+			matched[i] = match(i, chapter)
+		}
+		return matched
+	}
+
+	if term == "all" {
+		return each(func(int, *ChapterInfo) bool { return true }), nil
+	}
+	if term == "missing" {
+		return each(func(_ int, chapter *ChapterInfo) bool { return !chapter.Local }), nil
+	}
+	if name, keyword, ok := strings.Cut(term, "~"); ok && name == "name" {
+		return each(func(_ int, chapter *ChapterInfo) bool { return strings.Contains(chapter.Name, keyword) }), nil
+	}
+
+	key, value, ok := strings.Cut(term, ":")
+	if !ok {
+		return selectRange(term, matched)
+	}
+	switch key {
+	case "latest":
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("无效的章节选择: %s", term)
+		}
+		return each(func(i int, _ *ChapterInfo) bool { return i >= len(chapters)-count }), nil
+	case "after":
+		found := -1
+		for i, chapter := range chapters {
+			if chapter.UUID == value {
+				found = i
+			}
+		}
+		if found < 0 {
+			return nil, fmt.Errorf("没有找到章节: %s", value)
+		}
+		return each(func(i int, _ *ChapterInfo) bool { return i > found }), nil
+	case "since":
+		since, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("无效的日期: %s", value)
+		}
+		return each(func(_ int, chapter *ChapterInfo) bool {
+			created, err := time.Parse("2006-01-02", chapter.DatetimeCreated)
+			return err == nil && !created.Before(since)
+		}), nil
+	case "group":
+		return each(func(_ int, chapter *ChapterInfo) bool { return chapter.GroupPathWord == value }), nil
+	}
+	return nil, fmt.Errorf("无效的章节选择: %s", term)
+}
+
+// selectRange 解析 3 或 1-20 形式的序号
+func selectRange(term string, matched []bool) ([]bool, error) {
+	start, end := term, term
+	if before, after, ok := strings.Cut(term, "-"); ok {
+		start, end = before, after
+	}
+	from, err1 := strconv.Atoi(start)
+	to, err2 := strconv.Atoi(end)
+	if err1 != nil || err2 != nil || from < 1 || to < from {
+		return nil, fmt.Errorf("无效的章节选择: %s", term)
+	}
+	for i := from; i <= to && i <= len(matched); i++ {
+		matched[i-1] = true
+	}
+	return matched, nil
+}
+
+// selectionGroup 返回表达式中 group: 指定的分组, 调用方需要先获取该分组的章节列表
+func selectionGroup(expr string) string {
+	for _, term := range strings.FieldsFunc(expr, func(r rune) bool { return r == ' ' || r == '+' || r == ',' }) {
+		if key, value, ok := strings.Cut(term, ":"); ok && key == "group" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Select 获取章节列表并按表达式选择章节
+func (d *Downloader) Select(expr string) ([]int, error) {
+	if group := selectionGroup(expr); group != "" && group != d.group {
+		d.group = group
+		d.ChapterList = nil
+	}
+	if d.ChapterList == nil {
+		if err := d.GetComicInfo(); err != nil {
+			return nil, err
+		}
+	}
+	LibraryInstance.markLocal(d.bookInfo.UUID, d.pathWord, d.ChapterList)
+	return SelectChapters(expr, d.ChapterList)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectChapters(t *testing.T) {
+	chapters := []*ChapterInfo{
+		{UUID: "a", Name: "第1话", DatetimeCreated: "2025-12-01", GroupPathWord: "default", Local: true},
+		{UUID: "b", Name: "第2话", DatetimeCreated: "2025-12-20", GroupPathWord: "default", Local: true},
+		{UUID: "c", Name: "番外1", DatetimeCreated: "2026-01-01", GroupPathWord: "default"},
+		{UUID: "d", Name: "第3话", DatetimeCreated: "2026-01-15", GroupPathWord: "default"},
+		{UUID: "e", Name: "第1卷", DatetimeCreated: "2026-02-01", GroupPathWord: "tankobon"},
+	}
+	tests := []struct {
+		expr string
+		want []int
+	}{
+		{"", []int{0, 1, 2, 3, 4}},
+		{"all", []int{0, 1, 2, 3, 4}},
+		{"3", []int{2}},
+		{"1-2, 4", []int{0, 1, 3}},
+		{"4-10", []int{3, 4}},
+		{"latest:2", []int{3, 4}},
+		{"latest:0", []int{}},
+		{"after:b", []int{2, 3, 4}},
+		{"since:2026-01-01", []int{2, 3, 4}},
+		{"group:tankobon", []int{4}},
+		{"name~番外", []int{2}},
+		{"missing", []int{2, 3, 4}},
+		// 子句内取交集, 子句间取并集
+		{"missing+group:default", []int{2, 3}},
+		{"missing group:default, 1", []int{0, 2, 3}},
+	}
+	for _, tt := range tests {
+		got, err := SelectChapters(tt.expr, chapters)
+		if err != nil {
+			t.Errorf("SelectChapters(%q): %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SelectChapters(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestSelectChaptersInvalid(t *testing.T) {
+	chapters := []*ChapterInfo{{UUID: "a", Name: "第1话"}}
+	for _, expr := range []string{"0", "3-1", "x", "latest:-1", "latest:x", "after:z", "since:yesterday", "sort:asc"} {
+		if got, err := SelectChapters(expr, chapters); err == nil {
+			t.Errorf("SelectChapters(%q) = %v, want error", expr, got)
+		}
+	}
+}
+
+func TestSelectionGroup(t *testing.T) {
+	tests := []struct{ expr, want string }{
+		{"latest:5", ""},
+		{"group:tankobon", "tankobon"},
+		{"missing+group:tankobon", "tankobon"},
+		{"1-3, group:other latest:1", "other"},
+	}
+	for _, tt := range tests {
+		if got := selectionGroup(tt.expr); got != tt.want {
+			t.Errorf("selectionGroup(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server 以 HTTP/JSON 接口提供 DownloaderManager 和 Config 的功能,
+// 进度事件通过 Server-Sent Events 推送, 内容与界面收到的事件相同
+type Server struct {
+	token string
+	// 嵌入的前端页面, 为空时只提供接口
+	ui           http.Handler
+	manager      *DownloaderManager
+	subscription *SubscriptionManager
+	events       *eventHub
+}
+
+func NewServer(token string) *Server {
+	manager := &DownloaderManager{downloaders: make([]*DownloaderSingle, 0, 200)}
+	return &Server{
+		token:        token,
+		manager:      manager,
+		subscription: NewSubscriptionManager("subscriptions.json", manager),
+		events:       newEventHub(),
+	}
+}
+
+// serverToken 返回配置中的访问令牌, 未配置时生成并保存
+func serverToken() (string, error) {
+	if ConfigInstance.ServerToken != "" {
+		return ConfigInstance.ServerToken, nil
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	ConfigInstance.ServerToken = hex.EncodeToString(buf)
+	ConfigInstance.Save()
+	return ConfigInstance.ServerToken, nil
+}
+
+// ListenAndServe 启动下载调度和订阅检查, 然后在 addr 上提供接口直到 ctx 结束
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	s.manager.start(ctx, s.events.emit)
+	s.subscription.startup(ctx)
+
+	server := &http.Server{Addr: addr, Handler: s.Handler()}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/search", s.handleSearch)
+	api.HandleFunc("GET /api/comic", s.handleComic)
+	api.HandleFunc("GET /api/chapters", s.handleChapters)
+	api.HandleFunc("GET /api/downloads", s.handleDownloads)
+	api.HandleFunc("POST /api/downloads", s.handleEnqueue)
+	api.HandleFunc("DELETE /api/downloads", s.handleClearDownloads)
+	api.HandleFunc("GET /api/scheduler", s.handleScheduler)
+	api.HandleFunc("GET /api/config", s.handleGetConfig)
+	api.HandleFunc("PUT /api/config", s.handleSaveConfig)
+	api.HandleFunc("GET /api/events", s.handleEvents)
+	api.HandleFunc("POST /api/bindings/{name}", s.handleBinding)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.authenticate(api))
+	if s.ui != nil {
+		mux.Handle("/", s.ui)
+	}
+	return mux
+}
+
+// authenticate 校验 Authorization: Bearer <token>, EventSource 无法设置请求头, 也接受 token 参数
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintln(logOutput, "Error writing response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	comics, err := Search(ConfigInstance.UrlBase, r.URL.Query().Get("q"), page)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJson(w, comics)
+}
+
+// openComic 按 input 和 selection 参数获取漫画和选中的章节
+func openComic(r *http.Request) (*Downloader, []int, int, error) {
+	resolved, err := ResolveInput(r.URL.Query().Get("input"))
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+	downloader := NewDownloader(ConfigInstance.UrlBase, resolved.PathWord, ConfigInstance)
+	indexes, err := downloader.Select(r.URL.Query().Get("selection"))
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+	return downloader, indexes, http.StatusOK, nil
+}
+
+func (s *Server) handleComic(w http.ResponseWriter, r *http.Request) {
+	downloader, _, status, err := openComic(r)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	writeJson(w, struct {
+		PathWord string    `json:"pathWord"`
+		BookInfo *BookInfo `json:"bookInfo"`
+		Chapters int       `json:"chapters"`
+	}{downloader.pathWord, downloader.bookInfo, len(downloader.ChapterList)})
+}
+
+func (s *Server) handleChapters(w http.ResponseWriter, r *http.Request) {
+	downloader, indexes, status, err := openComic(r)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	writeJson(w, ChapterSelection{Chapters: downloader.ChapterList, Selected: indexes})
+}
+
+func (s *Server) handleDownloads(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, s.manager.GetDownloaders())
+}
+
+// handleEnqueue 加入下载队列, 请求体为 {"input": "...", "selection": "...", "format": "...", "bundle": "..."},
+// bundle 不为空时合并下载
+func (s *Server) handleEnqueue(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Input     string `json:"input"`
+		Selection string `json:"selection"`
+		Format    string `json:"format"`
+		Bundle    string `json:"bundle"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.Format != "" && !isPackageType(request.Format) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("未知的打包格式: %s", request.Format))
+		return
+	}
+	resolved, err := ResolveInput(request.Input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.Bundle != "" && resolved.ChapterUUID != "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("合并下载需要漫画而不是单个章节"))
+		return
+	}
+	var queued int
+	if request.Bundle != "" {
+		queued, err = s.manager.queueBundle(resolved.PathWord, request.Selection, request.Format, request.Bundle)
+	} else {
+		queued, err = s.manager.queueInput(resolved.PathWord, resolved.ChapterUUID, request.Selection, request.Format)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJson(w, struct {
+		Queued int `json:"queued"`
+	}{queued})
+}
+
+func (s *Server) handleClearDownloads(w http.ResponseWriter, r *http.Request) {
+	s.manager.ClearDownloaders()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleScheduler(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, s.manager.GetSchedulerState())
+}
+
+// publicConfig 返回不包含账号和访问令牌的配置副本
+func publicConfig() *Config {
+	config := *ConfigInstance
+	config.UserList = nil
+	config.ServerToken = ""
+	return &config
+}
+
+func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, publicConfig())
+}
+
+func (s *Server) handleSaveConfig(w http.ResponseWriter, r *http.Request) {
+	var config Config
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := saveRemoteConfig(&config); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// saveRemoteConfig 保存通过 HTTP 提交的配置. 输出目录决定了服务器上写入文件的位置,
+// 只能在本机修改, 为空时沿用当前设置
+func saveRemoteConfig(config *Config) error {
+	if config.OutputPath == "" {
+		config.OutputPath = ConfigInstance.OutputPath
+	}
+	if config.OutputPath != ConfigInstance.OutputPath {
+		return fmt.Errorf("输出目录只能在本机修改")
+	}
+	ConfigInstance.SaveConfig(config)
+	return nil
+}
+
+// handleEvents 以 Server-Sent Events 推送进度事件. 连接建立时先发送 task:reset
+// 作为初始状态, 之后按事件增量更新
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+	s.events.send(events, EventTaskReset, s.manager.GetDownloaders())
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message, ok := <-events:
+			if !ok {
+				// 客户端处理太慢, 断开后由客户端重连并重新获取状态
+				return
+			}
+			w.Write(message)
+			flusher.Flush()
+		case <-time.After(30 * time.Second):
+			w.Write([]byte(": ping\n\n"))
+			flusher.Flush()
+		}
+	}
+}
+
+// eventHub 把进度事件分发给所有 SSE 连接
+type eventHub struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{clients: make(map[chan []byte]struct{})}
+}
+
+func (h *eventHub) subscribe() chan []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events := make(chan []byte, 64)
+	h.clients[events] = struct{}{}
+	return events
+}
+
+func (h *eventHub) unsubscribe(events chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[events]; ok {
+		delete(h.clients, events)
+		close(events)
+	}
+}
+
+func eventMessage(eventName string, payload interface{}) []byte {
+	content, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Fprintln(logOutput, "Error serializing event:", err)
+		return nil
+	}
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", eventName, content))
+}
+
+// send 只发给单个连接, 连接已被 emit 断开时不再发送
+func (h *eventHub) send(events chan []byte, eventName string, payload interface{}) {
+	message := eventMessage(eventName, payload)
+	if message == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[events]; ok {
+		h.deliver(events, message)
+	}
+}
+
+// deliver 不阻塞地发送事件, 需要持有 h.mu. 通道只在持有 h.mu 时关闭
+func (h *eventHub) deliver(events chan []byte, message []byte) {
+	select {
+	case events <- message:
+	default:
+		// 丢弃事件会导致客户端状态不一致, 直接断开
+		delete(h.clients, events)
+		close(events)
+	}
+}
+
+// emit 与 runtime.EventsEmit 的参数相同, 只有一个参数时直接作为事件数据
+func (h *eventHub) emit(eventName string, data ...interface{}) {
+	var payload interface{} = data
+	if len(data) == 1 {
+		payload = data[0]
+	}
+	message := eventMessage(eventName, payload)
+	if message == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for events := range h.clients {
+		h.deliver(events, message)
+	}
+}
+
+func (c *cli) serve(args []string) int {
+	token := c.flags["token"]
+	if token == "" {
+		var err error
+		if token, err = serverToken(); err != nil {
+			return c.fail(err)
+		}
+	}
+	addr := c.flags["addr"]
+	if addr == "" {
+		addr = ":8080"
+	}
+	server := NewServer(token)
+	if _, ok := c.flags["no-ui"]; !ok {
+		dist, err := fs.Sub(assets, "frontend/dist")
+		if err != nil {
+			return c.fail(err)
+		}
+		if server.ui, err = uiHandler(dist); err != nil {
+			return c.fail(err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Listening on %s, token %s\n", addr, token)
+	if err := server.ListenAndServe(context.Background(), addr); err != nil {
+		return c.fail(err)
+	}
+	return exitOK
+}
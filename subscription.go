@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subscription 订阅的漫画, 定期检查并自动下载新章节
+type Subscription struct {
+	PathWord string `json:"pathWord"`
+	Name     string `json:"name"`
+	// 章节分组, 为空时使用 default
+	Group string `json:"group"`
+	// 打包方式和命名风格, 为空时使用全局配置
+	PackageType string `json:"packageType"`
+	NamingStyle string `json:"namingStyle"`
+	// 章节选择表达式, 只自动下载匹配的新章节, 为空时下载全部
+	Selection string `json:"selection"`
+	// 源站替换了已下载的章节时是否重新下载
+	RefetchChanged bool `json:"refetchChanged"`
+	// 已下载完成的章节 UUID
+	Downloaded []string  `json:"downloaded"`
+	LastCheck  time.Time `json:"lastCheck"`
+	LastError  string    `json:"lastError"`
+}
+
+type SubscriptionManager struct {
+	mu            sync.Mutex
+	path          string
+	subscriptions []*Subscription
+	// 已加入下载队列但尚未完成的章节, 避免重复加入
+	pending map[string]bool
+	manager *DownloaderManager
+	wake    chan struct{}
+}
+
+func NewSubscriptionManager(path string, manager *DownloaderManager) *SubscriptionManager {
+	s := &SubscriptionManager{
+		path:    path,
+		pending: make(map[string]bool),
+		manager: manager,
+		wake:    make(chan struct{}, 1),
+	}
+	content, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(content, &s.subscriptions); err != nil {
+			fmt.Fprintln(logOutput, "Error deserializing subscriptions:", err)
+		}
+	}
+	return s
+}
+
+func (s *SubscriptionManager) startup(ctx context.Context) {
+	s.manager.onTaskDone(s.taskDone)
+	go s.run(ctx)
+}
+
+// save 需要在持有 mu 时调用
+func (s *SubscriptionManager) save() {
+	content, err := json.MarshalIndent(s.subscriptions, "", "  ")
+	if err != nil {
+		fmt.Fprintln(logOutput, "Error serializing subscriptions:", err)
+		return
+	}
+	err = atomicWriteFile(s.path, func(f *os.File) error {
+		_, err := f.Write(content)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintln(logOutput, "Error writing subscriptions file:", err)
+	}
+}
+
+func (s *SubscriptionManager) find(pathWord string) *Subscription {
+	for _, sub := range s.subscriptions {
+		if sub.PathWord == pathWord {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (s *SubscriptionManager) GetSubscriptions() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		list = append(list, *sub)
+	}
+	return list
+}
+
+// Subscribe 添加或更新订阅. downloadExisting 为 false 时,
+// 当前已有的章节视为已下载, 只下载之后更新的章节
+func (s *SubscriptionManager) Subscribe(subscription Subscription, downloadExisting bool) error {
+	if subscription.PathWord == "" {
+		return fmt.Errorf("path word is empty")
+	}
+	// 界面中可以直接填写漫画链接
+	if resolved, err := ResolveInput(subscription.PathWord); err == nil {
+		subscription.PathWord = resolved.PathWord
+	}
+	if subscription.Group == "" {
+		subscription.Group = "default"
+	}
+
+	downloader := NewDownloader(ConfigInstance.UrlBase, subscription.PathWord, ConfigInstance)
+	downloader.group = subscription.Group
+	if err := downloader.GetComicInfo(); err != nil {
+		return err
+	}
+	if _, err := SelectChapters(subscription.Selection, downloader.ChapterList); err != nil {
+		return err
+	}
+	if subscription.Name == "" {
+		subscription.Name = downloader.bookInfo.Series
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub := s.find(subscription.PathWord); sub != nil {
+		sub.Name = subscription.Name
+		sub.Group = subscription.Group
+		sub.PackageType = subscription.PackageType
+		sub.NamingStyle = subscription.NamingStyle
+		sub.Selection = subscription.Selection
+		sub.RefetchChanged = subscription.RefetchChanged
+	} else {
+		subscription.Downloaded = nil
+		if !downloadExisting {
+			for _, chapter := range downloader.ChapterList {
+				subscription.Downloaded = append(subscription.Downloaded, chapter.UUID)
+			}
+		}
+		s.subscriptions = append(s.subscriptions, &subscription)
+	}
+	s.save()
+	s.notify()
+	return nil
+}
+
+func (s *SubscriptionManager) Unsubscribe(pathWord string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sub := range s.subscriptions {
+		if sub.PathWord == pathWord {
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			break
+		}
+	}
+	s.save()
+}
+
+// CheckNow 立即检查所有订阅
+func (s *SubscriptionManager) CheckNow() {
+	s.notify()
+}
+
+func (s *SubscriptionManager) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *SubscriptionManager) run(ctx context.Context) {
+	for {
+		s.checkAll()
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-time.After(ConfigInstance.subscriptionInterval()):
+		}
+	}
+}
+
+func (s *SubscriptionManager) checkAll() {
+	s.mu.Lock()
+	pathWords := make([]string, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		pathWords = append(pathWords, sub.PathWord)
+	}
+	s.mu.Unlock()
+
+	for _, pathWord := range pathWords {
+		s.check(pathWord)
+	}
+}
+
+// check 对比远端章节与已下载章节, 把新章节加入下载队列
+func (s *SubscriptionManager) check(pathWord string) {
+	s.mu.Lock()
+	sub := s.find(pathWord)
+	if sub == nil {
+		s.mu.Unlock()
+		return
+	}
+	config := ConfigInstance.withOverrides(sub.PackageType, sub.NamingStyle)
+	downloader := NewDownloader(ConfigInstance.UrlBase, sub.PathWord, config)
+	if sub.Group != "" {
+		downloader.group = sub.Group
+	}
+	s.mu.Unlock()
+
+	err := downloader.GetComicInfo()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 检查期间订阅可能已被取消
+	if sub = s.find(pathWord); sub == nil {
+		return
+	}
+	sub.LastCheck = time.Now()
+	if err != nil {
+		sub.LastError = err.Error()
+		s.save()
+		return
+	}
+	sub.LastError = ""
+
+	downloaded := make(map[string]bool, len(sub.Downloaded))
+	for _, uuid := range sub.Downloaded {
+		downloaded[uuid] = true
+	}
+	LibraryInstance.markLocal(downloader.bookInfo.UUID, downloader.pathWord, downloader.ChapterList)
+	candidates, err := SelectChapters(sub.Selection, downloader.ChapterList)
+	if err != nil {
+		sub.LastError = err.Error()
+		s.save()
+		return
+	}
+	var indexes []int
+	for _, i := range candidates {
+		chapter := downloader.ChapterList[i]
+		if downloaded[chapter.UUID] || s.pending[chapter.UUID] {
+			continue
+		}
+		if !LibraryInstance.hasChapter(downloader.bookInfo.UUID, downloader.pathWord, chapter.UUID) {
+			indexes = append(indexes, i)
+			s.pending[chapter.UUID] = true
+		}
+	}
+	tasks := downloader.GetDownloadList(indexes)
+
+	// 源站替换过的章节按原格式重新下载, 旧文件会保留在 .versions 中
+	// 比较页面指纹需要逐个请求章节, 只在会重新下载时进行
+	var fingerprints func(*ChapterInfo) ([]string, error)
+	if sub.RefetchChanged {
+		fingerprints = downloader.chapterFingerprints
+	}
+	changed := LibraryInstance.detectChanges(downloader.bookInfo.UUID, downloader.pathWord, downloader.ChapterList, fingerprints)
+	if sub.RefetchChanged {
+		var bundled []string
+		for _, local := range changed {
+			if s.pending[local.UUID] {
+				continue
+			}
+			// 单独重新下载会用一个章节覆盖整个合并文件
+			if local.Bundle != "" {
+				fmt.Fprintln(logOutput, "Error refetching chapter: bundled in", local.FilePath)
+				bundled = append(bundled, local.Name)
+				continue
+			}
+			if task := downloader.redownloadTask(local.UUID, local.Format, local.FilePath); task != nil {
+				tasks = append(tasks, task)
+				s.pending[local.UUID] = true
+			}
+		}
+		if len(bundled) > 0 {
+			sub.LastError = "合并文件中的章节已更新, 需要重新合并下载: " + strings.Join(bundled, ", ")
+		}
+	}
+	s.save()
+
+	if len(tasks) > 0 {
+		go s.manager.enqueue(tasks)
+	}
+}
+
+// taskDone 在下载任务结束时记录章节, 失败的章节在下次检查时重试
+func (s *SubscriptionManager) taskDone(task *DownloaderSingle, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uuid := task.Chapter.UUID
+	if !s.pending[uuid] {
+		return
+	}
+	delete(s.pending, uuid)
+	if err != nil {
+		return
+	}
+	sub := s.find(task.PathWord)
+	if sub == nil {
+		return
+	}
+	for _, downloaded := range sub.Downloaded {
+		if downloaded == uuid {
+			return
+		}
+	}
+	sub.Downloaded = append(sub.Downloaded, uuid)
+	s.save()
+}
@@ -2,12 +2,21 @@ package main
 
 import (
 	"bytes"
+	"io"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+// logOutput 下载和后台任务的日志输出. 命令行模式下改为 stderr, stdout 只输出命令结果
+var logOutput io.Writer = os.Stdout
+
 const passwordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()"
 
 func GeneratePassword(length int) string {
@@ -36,6 +45,11 @@ func GenerateUsername(length int) string {
 
 var illegalChars = regexp.MustCompile(`[<>:"/\\|?*]+`)
 
+// stableUUID 由输入生成固定的第 5 版 UUID, 同一输出文件每次打包得到相同的标识
+func stableUUID(parts ...string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(strings.Join(parts, "/"))).String()
+}
+
 func sanitizeFilename(filename string) string {
 	filename = illegalChars.ReplaceAllString(filename, "")
 
@@ -48,6 +62,56 @@ func sanitizeFilename(filename string) string {
 	return filename
 }
 
+// atomicWriteFile 先写入同目录下的临时文件, 成功后再重命名到 path,
+// 中途崩溃不会留下看似完整的半截文件
+func atomicWriteFile(path string, write func(f *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// listPageFiles 按文件名顺序返回目录中的图片, 跳过未完成的临时文件
+func listPageFiles(imgPath string) ([]string, error) {
+	entries, err := os.ReadDir(imgPath)
+	if err != nil {
+		return nil, err
+	}
+	var pages []string
+	for _, entry := range entries {
+		if entry.IsDir() || isTempFile(entry.Name()) || !isImageName(entry.Name()) {
+			continue
+		}
+		pages = append(pages, filepath.Join(imgPath, entry.Name()))
+	}
+	sort.Strings(pages)
+	return pages, nil
+}
+
+// isTempFile 判断是否为 atomicWriteFile 遗留的临时文件
+func isTempFile(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp")
+}
+
 func isImage(data []byte) bool {
 	// PNG文件的前缀字节
 	if bytes.HasPrefix(data, []byte{0x89, 0x50, 0x4E, 0x47}) {
@@ -64,14 +128,17 @@ func isImage(data []byte) bool {
 		return true
 	}
 
-	// WebP文件的前缀字节
-	if bytes.HasPrefix(data, []byte{'R', 'I', 'F', 'F'}) && bytes.HasPrefix(data[8:], []byte{'W', 'E', 'B', 'P'}) {
+	// WebP文件的前缀字节: RIFF....WEBP
+	if len(data) >= 12 && bytes.HasPrefix(data, []byte{'R', 'I', 'F', 'F'}) && bytes.Equal(data[8:12], []byte{'W', 'E', 'B', 'P'}) {
 		return true
 	}
 
-	// AVIF文件的前缀字节
-	if bytes.HasPrefix(data, []byte{'f', 't', 'y', 'p'}) && bytes.Contains(data[4:], []byte("avif")) {
-		return true
+	// AVIF文件: 第一个 box 为 ftyp, 品牌列表中包含 avif/avis
+	if len(data) >= 12 && bytes.Equal(data[4:8], []byte{'f', 't', 'y', 'p'}) {
+		brands := data[8:min(len(data), 32)]
+		if bytes.Contains(brands, []byte("avif")) || bytes.Contains(brands, []byte("avis")) {
+			return true
+		}
 	}
 
 	// 其他常见格式可以继续扩展
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"strings"
+)
+
+// validatePackage 检查生成的 EPUB, KEPUB, CBZ 或 MOBI/AZW3 的结构, 其他格式不检查.
+// 发现的所有问题合并为一个错误返回
+func validatePackage(filePath string, format string) error {
+	var problems []string
+	switch format {
+	case "epub", "kepub":
+		problems = validateEpub(filePath)
+	case "cbz":
+		problems = validateCbz(filePath)
+	case "mobi", "azw3":
+		problems = validateMobi(filePath)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateEpub 检查 mimetype, container.xml 到 OPF 的引用, manifest 与压缩包内文件是否一致,
+// spine 引用, 图片的媒体类型, 目录以及 XML 格式
+func validateEpub(filePath string) []string {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid archive: %v", err)}
+	}
+	defer reader.Close()
+
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// mimetype 必须是第一个文件且不压缩
+	if len(reader.File) == 0 || reader.File[0].Name != "mimetype" {
+		addProblem("mimetype is not the first entry")
+	} else if mimetype := reader.File[0]; mimetype.Method != zip.Store {
+		addProblem("mimetype is compressed")
+	} else if content, err := readZipEntry(mimetype); err != nil || string(content) != "application/epub+zip" {
+		addProblem("invalid mimetype content")
+	}
+
+	files := make(map[string]*zip.File, len(reader.File))
+	for _, f := range reader.File {
+		files[f.Name] = f
+		if isXmlName(f.Name) {
+			if err := checkXmlEntry(f); err != nil {
+				addProblem("%s: %v", f.Name, err)
+			}
+		}
+	}
+
+	opf, opfPath, err := readOpf(&reader.Reader)
+	if err != nil {
+		addProblem("%v", err)
+		return problems
+	}
+	opfDir := path.Dir(opfPath)
+
+	ids := make(map[string]bool, len(opf.Manifest.Items))
+	declared := map[string]bool{"mimetype": true, opfPath: true}
+	navCount := 0
+	for _, item := range opf.Manifest.Items {
+		if ids[item.ID] {
+			addProblem("duplicate manifest id %s", item.ID)
+		}
+		ids[item.ID] = true
+		name := path.Join(opfDir, item.Href)
+		declared[name] = true
+		f, ok := files[name]
+		if !ok {
+			addProblem("manifest item %s is missing from archive", item.Href)
+			continue
+		}
+		if strings.Contains(item.Properties, "nav") {
+			navCount++
+			if content, err := readZipEntry(f); err != nil || !bytes.Contains(content, []byte(`epub:type="toc"`)) {
+				addProblem("nav %s has no toc", item.Href)
+			}
+		}
+		if strings.HasPrefix(item.MediaType, "image/") {
+			content, err := readZipEntry(f)
+			if err != nil {
+				addProblem("%s: %v", item.Href, err)
+				continue
+			}
+			if _, format, err := image.DecodeConfig(bytes.NewReader(content)); err != nil {
+				addProblem("%s: %v", item.Href, err)
+			} else if item.MediaType != "image/"+format {
+				addProblem("%s is declared %s but is image/%s", item.Href, item.MediaType, format)
+			}
+		}
+	}
+	if navCount != 1 {
+		addProblem("expected one nav document, found %d", navCount)
+	}
+
+	// META-INF 以外的文件都需要在 manifest 中声明
+	for _, f := range reader.File {
+		if !declared[f.Name] && !strings.HasPrefix(f.Name, "META-INF/") && !strings.HasSuffix(f.Name, "/") {
+			addProblem("%s is not declared in manifest", f.Name)
+		}
+	}
+
+	if len(opf.Spine.ItemRefs) == 0 {
+		addProblem("spine is empty")
+	}
+	for _, itemRef := range opf.Spine.ItemRefs {
+		if !ids[itemRef.IDRef] {
+			addProblem("spine references unknown id %s", itemRef.IDRef)
+		}
+	}
+	if opf.Spine.Toc != "" && !ids[opf.Spine.Toc] {
+		addProblem("spine toc references unknown id %s", opf.Spine.Toc)
+	}
+	return problems
+}
+
+// validateCbz 检查 ComicInfo.xml 能否解析, 页数是否与图片数一致, 并用 ValidatePartial 做部分 schema 检查
+func validateCbz(filePath string) []string {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid archive: %v", err)}
+	}
+	defer reader.Close()
+
+	pages := 0
+	var comicInfoFile *zip.File
+	for _, f := range reader.File {
+		if isImageName(f.Name) {
+			pages++
+		} else if f.Name == "ComicInfo.xml" {
+			comicInfoFile = f
+		}
+	}
+	if comicInfoFile == nil {
+		return []string{"missing ComicInfo.xml"}
+	}
+	content, err := readZipEntry(comicInfoFile)
+	if err != nil {
+		return []string{fmt.Sprintf("ComicInfo.xml: %v", err)}
+	}
+
+	var problems []string
+	var comicInfo ComicInfo
+	if err := xml.Unmarshal(content, &comicInfo); err != nil {
+		return []string{fmt.Sprintf("invalid ComicInfo.xml: %v", err)}
+	}
+	if err := comicInfo.ValidatePartial(); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid ComicInfo.xml: %v", err))
+	}
+	if comicInfo.PageCount != 0 && comicInfo.PageCount != pages {
+		problems = append(problems, fmt.Sprintf("page count mismatch: ComicInfo has %d, archive has %d", comicInfo.PageCount, pages))
+	}
+	if comicInfo.Pages != nil && len(comicInfo.Pages.Page) != pages {
+		problems = append(problems, fmt.Sprintf("ComicInfo has %d Page entries, archive has %d images", len(comicInfo.Pages.Page), pages))
+	}
+	return problems
+}
+
+func isXmlName(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".xml", ".opf", ".ncx", ".xhtml":
+		return true
+	}
+	return false
+}
+
+// checkXmlEntry 检查 XML 是否格式正确
+func checkXmlEntry(f *zip.File) error {
+	content, err := readZipEntry(f)
+	if err != nil {
+		return err
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
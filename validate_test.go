@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltPackagesPassVerify(t *testing.T) {
+	dir := t.TempDir()
+	pagesDir := filepath.Join(dir, "pages")
+	if err := os.Mkdir(pagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		f, err := os.Create(filepath.Join(pagesDir, fmt.Sprintf("%03d.png", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 8, 12))); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	builds := map[string]func(path string) error{
+		"epub": func(path string) error {
+			eb := EpubBuilder{metadata: NewMetaData("第1话", nil, nil, nil, nil, nil, nil, nil, nil)}
+			return eb.BuildComicChapters(path, []ComicChapter{{Title: "第1话", ImgPath: pagesDir}})
+		},
+		"kepub": func(path string) error {
+			eb := EpubBuilder{metadata: NewMetaData("第1话", nil, nil, nil, nil, nil, nil, nil, nil), kobo: true}
+			return eb.BuildComicChapters(path, []ComicChapter{{Title: "第1话", ImgPath: pagesDir}})
+		},
+		"mobi": func(path string) error {
+			mb := MobiBuilder{Title: "第1话"}
+			if err := mb.AddChapter("第1话", pagesDir); err != nil {
+				return err
+			}
+			return mb.Build(path)
+		},
+		"pdf": func(path string) error {
+			pb := PdfBuilder{Title: "第1话"}
+			if err := pb.AddChapter("第1话", pagesDir); err != nil {
+				return err
+			}
+			return pb.Build(path)
+		},
+	}
+	builds["azw3"] = builds["mobi"]
+
+	for format, build := range builds {
+		path := filepath.Join(dir, "chapter."+format)
+		if err := build(path); err != nil {
+			t.Errorf("%s: build: %v", format, err)
+			continue
+		}
+		if err := verifyChapterFile(path, format, 2); err != nil {
+			t.Errorf("%s: verifyChapterFile: %v", format, err)
+		}
+		if err := validatePackage(path, format); err != nil {
+			t.Errorf("%s: validatePackage: %v", format, err)
+		}
+	}
+}
+
+// 缺少 ComicInfo.xml 的 CBZ 只是不符合规范, 校验不应判定为损坏
+func TestVerifyIgnoresNonCompliantPackage(t *testing.T) {
+	dir := t.TempDir()
+	pagesDir := filepath.Join(dir, "pages")
+	if err := os.Mkdir(pagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(pagesDir, "001.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 8, 12))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	path := filepath.Join(dir, "chapter.cbz")
+	if err := CreateZipFromDirectory(pagesDir, path, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyChapterFile(path, "cbz", 1); err != nil {
+		t.Errorf("verifyChapterFile: %v", err)
+	}
+	if err := validatePackage(path, "cbz"); err == nil || !strings.Contains(err.Error(), "missing ComicInfo.xml") {
+		t.Errorf("validatePackage = %v, want missing ComicInfo.xml", err)
+	}
+	if err := verifyChapterFile(path, "cbz", 2); err == nil {
+		t.Error("verifyChapterFile accepted a page count mismatch")
+	}
+}
+
+// 题材中的特殊字符需要转义, 否则 OPF 不是合法的 XML
+func TestEpubEscapesSubject(t *testing.T) {
+	dir := t.TempDir()
+	pagesDir := filepath.Join(dir, "pages")
+	if err := os.Mkdir(pagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(pagesDir, "001.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 8, 12))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	subject := []string{"恋爱&校园", "<冒险>"}
+	eb := EpubBuilder{metadata: NewMetaData("第1话", nil, nil, nil, nil, subject, nil, nil, nil)}
+	path := filepath.Join(dir, "chapter.epub")
+	if err := eb.BuildComicChapters(path, []ComicChapter{{Title: "第1话", ImgPath: pagesDir}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validatePackage(path, "epub"); err != nil {
+		t.Errorf("validatePackage: %v", err)
+	}
+	if subject[0] != "恋爱&校园" {
+		t.Errorf("NewMetaData modified the subject slice: %q", subject)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const versionsDir = ".versions"
+
+// keepVersion 把即将被覆盖的旧文件移动到同目录下的 .versions 文件夹,
+// 每个文件最多保留 retention 个历史版本
+func keepVersion(filePath string, retention int) error {
+	if _, err := os.Stat(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if retention <= 0 {
+		return nil
+	}
+
+	dir := filepath.Join(filepath.Dir(filePath), versionsDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	base := filepath.Base(filePath)
+	name := trimPackageExt(base)
+	ext := base[len(name):]
+	versionPath := filepath.Join(dir, fmt.Sprintf("%s.%s%s", name, time.Now().Format("20060102-150405"), ext))
+	if err := os.Rename(filePath, versionPath); err != nil {
+		return err
+	}
+
+	// 只匹配 <name>.<时间戳><ext>, 避免把 Vol.1.5 之类的同名前缀文件当作历史版本.
+	// 时间戳格式保证按文件名排序即按时间排序
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `\.\d{8}-\d{6}` + regexp.QuoteMeta(ext) + `$`)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var matches []string
+	for _, entry := range entries {
+		if pattern.MatchString(entry.Name()) {
+			matches = append(matches, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(matches)
+	for len(matches) > retention {
+		os.Remove(matches[0])
+		matches = matches[1:]
+	}
+	return nil
+}
+
+// buildVersioned 先把新文件生成到同目录的临时文件, 成功后再保留旧版本并替换.
+// 生成失败时旧文件保持不变
+func buildVersioned(filePath string, retention int, build func(tmpPath string) error) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+	tmpPath := filepath.Join(filepath.Dir(filePath), "."+filepath.Base(filePath)+".new.tmp")
+	defer os.Remove(tmpPath)
+	if err := build(tmpPath); err != nil {
+		return err
+	}
+	if err := keepVersion(filePath, retention); err != nil {
+		fmt.Fprintln(logOutput, "Error keeping previous version:", err)
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+// packageExt 返回打包格式对应的文件扩展名, 图片目录返回空字符串
+func packageExt(packageType string) string {
+	switch packageType {
+	case "cbz", "cbt", "zip", "epub", "pdf", "mobi", "azw3":
+		return "." + packageType
+	case "kepub":
+		return ".kepub.epub"
+	}
+	return ""
+}
+
+// trimPackageExt 去掉文件名中的打包格式扩展名, .kepub.epub 整体去掉
+func trimPackageExt(file string) string {
+	if strings.HasSuffix(strings.ToLower(file), ".kepub.epub") {
+		return file[:len(file)-len(".kepub.epub")]
+	}
+	return strings.TrimSuffix(file, filepath.Ext(file))
+}
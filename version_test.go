@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestTrimPackageExt(t *testing.T) {
+	tests := []struct{ file, want string }{
+		{"第1话.cbz", "第1话"},
+		{"第1话.kepub.epub", "第1话"},
+		{"第1话.KEPUB.EPUB", "第1话"},
+		{"Vol.1.5.epub", "Vol.1.5"},
+		{"第1话", "第1话"},
+	}
+	for _, tt := range tests {
+		if got := trimPackageExt(tt.file); got != tt.want {
+			t.Errorf("trimPackageExt(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestKeepVersion(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "第1话.kepub.epub")
+	if err := os.WriteFile(file, []byte("current"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	versions := filepath.Join(dir, versionsDir)
+	if err := os.Mkdir(versions, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// 两个更早的版本, 以及名称前缀相同但不是历史版本的文件
+	for _, name := range []string{
+		"第1话.20240101-000000.kepub.epub",
+		"第1话.20240102-000000.kepub.epub",
+		"第1话.5.kepub.epub",
+	} {
+		if err := os.WriteFile(filepath.Join(versions, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := keepVersion(file, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("original file still exists: %v", err)
+	}
+	entries, err := os.ReadDir(versions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	pattern := regexp.MustCompile(`^第1话\.\d{8}-\d{6}\.kepub\.epub$`)
+	if len(names) != 3 || names[0] != "第1话.20240102-000000.kepub.epub" ||
+		!pattern.MatchString(names[1]) || names[2] != "第1话.5.kepub.epub" {
+		t.Errorf("versions = %q", names)
+	}
+}
+
+func TestKeepVersionDisabled(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "第1话.cbz")
+	if err := os.WriteFile(file, []byte("current"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := keepVersion(file, -1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, versionsDir)); !os.IsNotExist(err) {
+		t.Errorf("versions directory created with retention disabled: %v", err)
+	}
+	if err := keepVersion(filepath.Join(dir, "missing.cbz"), 3); err != nil {
+		t.Errorf("missing file: %v", err)
+	}
+}